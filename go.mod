@@ -3,8 +3,12 @@ module github.com/satyampsoni/new-relic-hackathon-o11y
 go 1.19
 
 require (
+	github.com/expr-lang/expr v1.16.9
 	github.com/itchyny/gojq v0.12.13
 	github.com/joho/godotenv v1.5.1
+	github.com/klauspost/compress v1.17.4
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
 	github.com/sirupsen/logrus v1.9.3
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -6,24 +6,30 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/transform"
 	"github.com/sirupsen/logrus"
 )
 
 // Manager handles alert delivery across multiple channels
 type Manager struct {
 	channels []config.AlertChannel
+	metadata *transform.Pipeline
 	client   *http.Client
 	logger   *logrus.Logger
 }
 
-// NewManager creates a new alert manager
-func NewManager(channels []config.AlertChannel, logger *logrus.Logger) *Manager {
+// NewManager creates a new alert manager. The metadata pipeline, if any,
+// is applied to alert metadata before it is sent, and the title and message
+// are redacted to match.
+func NewManager(channels []config.AlertChannel, metadata *transform.Pipeline, logger *logrus.Logger) *Manager {
 	return &Manager{
 		channels: channels,
+		metadata: metadata,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -50,6 +56,21 @@ func (m *Manager) SendAlert(alert Alert) error {
 		return nil
 	}
 
+	// Work on a copy so callers' maps are not modified
+	if m.metadata != nil && alert.Metadata != nil {
+		metadata := make(map[string]interface{}, len(alert.Metadata))
+		for k, v := range alert.Metadata {
+			metadata[k] = v
+		}
+		if err := m.metadata.Apply(metadata); err != nil {
+			m.logger.WithError(err).Debug("Alert metadata transform left values unchanged")
+		}
+		// The title and message repeat metadata values such as the error or URL
+		alert.Title = redactChanged(alert.Title, alert.Metadata, metadata)
+		alert.Message = redactChanged(alert.Message, alert.Metadata, metadata)
+		alert.Metadata = metadata
+	}
+
 	var errors []error
 	for _, channel := range m.channels {
 		if !channel.Enabled {
@@ -78,6 +99,40 @@ func (m *Manager) SendAlert(alert Alert) error {
 	return nil
 }
 
+// redactChanged replaces the original string metadata values that the
+// transform changed or dropped in text with their transformed value, or with
+// [redacted] when the field is gone
+func redactChanged(text string, before, after map[string]interface{}) string {
+	kept := make(map[string]bool, len(after))
+	for _, v := range after {
+		if s, ok := v.(string); ok {
+			kept[s] = true
+		}
+	}
+
+	var originals []string
+	replacements := make(map[string]string)
+	for k, v := range before {
+		original, ok := v.(string)
+		if !ok || original == "" || kept[original] {
+			continue
+		}
+		replacement := "[redacted]"
+		if value, ok := after[k]; ok {
+			replacement = fmt.Sprint(value)
+		}
+		originals = append(originals, original)
+		replacements[original] = replacement
+	}
+
+	// Longest first, so a value containing another is replaced whole
+	sort.Slice(originals, func(i, j int) bool { return len(originals[i]) > len(originals[j]) })
+	for _, original := range originals {
+		text = strings.ReplaceAll(text, original, replacements[original])
+	}
+	return text
+}
+
 // sendToChannel sends an alert to a specific channel
 func (m *Manager) sendToChannel(alert Alert, channel config.AlertChannel) error {
 	switch channel.Type {
@@ -294,6 +349,34 @@ func (m *Manager) SendErrorAlert(apiName, operation string, err error) error {
 	return m.SendAlert(alert)
 }
 
+// SendLimitAlert creates and sends an alert for an API that exceeded its
+// response size or record limit. observed is 0 when the size is unknown.
+func (m *Manager) SendLimitAlert(apiName, limit string, max, observed int64, behavior string) error {
+	message := fmt.Sprintf("API '%s' exceeded %s of %d, behavior: %s", apiName, limit, max, behavior)
+	if observed > 0 {
+		message = fmt.Sprintf("API '%s' exceeded %s of %d with %d, behavior: %s", apiName, limit, max, observed, behavior)
+	}
+
+	alert := Alert{
+		Type:      "limit_exceeded",
+		Severity:  "warning",
+		Title:     fmt.Sprintf("Limit Exceeded: %s", apiName),
+		Message:   message,
+		Source:    apiName,
+		Timestamp: time.Now(),
+		Metadata: map[string]interface{}{
+			"api_name": apiName,
+			"limit":    limit,
+			"max":      max,
+			"observed": observed,
+			"behavior": behavior,
+		},
+		Tags: []string{"limit", "file_monitor", apiName},
+	}
+
+	return m.SendAlert(alert)
+}
+
 // SendHealthAlert creates and sends a health check alert
 func (m *Manager) SendHealthAlert(component, status string, metadata map[string]interface{}) error {
 	severity := "info"
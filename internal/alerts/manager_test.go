@@ -0,0 +1,52 @@
+package alerts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/transform"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestAlertTransformsRedactMessage(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+
+	pipeline, err := transform.New([]config.TransformConfig{
+		{Type: "replace", Fields: []string{"url"}, Pattern: `token=[^&]+`, Replacement: "token=***"},
+		{Type: "drop", Fields: []string{"error"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	channels := []config.AlertChannel{{Type: "log", Name: "log", Enabled: true}}
+	manager := NewManager(channels, pipeline, logger)
+
+	manager.SendStalenessAlert("orders", "https://example.com/export?token=s3cret", time.Hour, time.Minute)
+	manager.SendErrorAlert("orders", "fetch", errors.New("GET https://example.com/export?token=s3cret: 401"))
+
+	var entries []*logrus.Entry
+	for _, entry := range hook.AllEntries() {
+		if _, ok := entry.Data["alert_type"]; ok {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 alerts, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		line, _ := entry.String()
+		if strings.Contains(line, "s3cret") {
+			t.Errorf("Alert leaked the token: %s", line)
+		}
+	}
+	if !strings.Contains(entries[0].Message, "https://example.com/export?token=***") {
+		t.Errorf("Expected the transformed URL in the message, got %q", entries[0].Message)
+	}
+	if !strings.Contains(entries[1].Message, "[redacted]") {
+		t.Errorf("Expected the dropped error to be redacted, got %q", entries[1].Message)
+	}
+}
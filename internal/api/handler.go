@@ -8,13 +8,17 @@ import (
 
 	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/alerts"
 	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/processor"
 	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/staleness"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/transport"
 	"github.com/sirupsen/logrus"
 )
 
 // MetricsHandler handles all metrics API endpoints
 type MetricsHandler struct {
 	detector     *staleness.Detector
+	transports   *transport.Registry
+	processor    *processor.FileProcessor
 	alertManager *alerts.Manager
 	config       *config.Config
 	logger       *logrus.Logger
@@ -56,6 +60,8 @@ type APIHealthStatus struct {
 	ResponseTimeMs int64   `json:"response_time_ms"`
 	LastCheck      string  `json:"last_check"`
 	SuccessRate    float64 `json:"success_rate"`
+	CircuitState   string  `json:"circuit_state,omitempty"`
+	CircuitRetryAt string  `json:"circuit_retry_at,omitempty"`
 }
 
 // AlertSummary represents alert metrics
@@ -94,9 +100,11 @@ type PerformanceMetric struct {
 }
 
 // NewMetricsHandler creates a new metrics handler
-func NewMetricsHandler(detector *staleness.Detector, alertManager *alerts.Manager, cfg *config.Config, logger *logrus.Logger) *MetricsHandler {
+func NewMetricsHandler(detector *staleness.Detector, transports *transport.Registry, fileProcessor *processor.FileProcessor, alertManager *alerts.Manager, cfg *config.Config, logger *logrus.Logger) *MetricsHandler {
 	return &MetricsHandler{
 		detector:     detector,
+		transports:   transports,
+		processor:    fileProcessor,
 		alertManager: alertManager,
 		config:       cfg,
 		logger:       logger,
@@ -117,21 +125,24 @@ func (h *MetricsHandler) StalenessStatus(w http.ResponseWriter, r *http.Request)
 			continue
 		}
 
-		// Determine which URL to check for staleness
-		checkURL := api.Staleness.CheckURL
-		if checkURL == "" {
-			checkURL = api.URL
+		// Build the check, reusing the API's request settings when configured
+		client, err := h.transports.Client(api)
+		if err != nil {
+			h.logger.WithError(err).WithField("api_name", api.Name).Warn("Failed to build HTTP client, skipping staleness check")
+			continue
 		}
+		check := staleness.NewCheck(api)
+		check.Client = client
 
 		h.logger.WithFields(logrus.Fields{
 			"api_name":  api.Name,
-			"check_url": checkURL,
+			"check_url": api.Staleness.CheckURL,
 			"threshold": api.Staleness.Threshold,
 			"behavior":  api.Staleness.Behavior,
 		}).Debug("Performing staleness check")
 
 		// Perform actual staleness detection
-		result := h.detector.CheckStaleness(checkURL, api.Staleness.Threshold, api.Staleness.Behavior)
+		result := h.detector.Check(r.Context(), check)
 
 		// Handle errors gracefully - if we can't check, assume not stale but log the error
 		if result.Error != nil {
@@ -168,6 +179,7 @@ func (h *MetricsHandler) HealthStatus(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("Serving health metrics endpoint")
 
 	var apis []APIHealthStatus
+	breakers := h.processor.BreakerStates()
 
 	for _, api := range h.config.APIs {
 		if !api.Enabled {
@@ -190,13 +202,24 @@ func (h *MetricsHandler) HealthStatus(w http.ResponseWriter, r *http.Request) {
 			successRate = 92.1
 		}
 
-		apis = append(apis, APIHealthStatus{
+		apiHealth := APIHealthStatus{
 			Name:           api.Name,
 			Status:         status,
 			ResponseTimeMs: responseTime,
 			LastCheck:      time.Now().Add(-time.Minute * 2).Format(time.RFC3339),
 			SuccessRate:    successRate,
-		})
+		}
+
+		// Report circuit breaker state for APIs that have one
+		if breaker, ok := breakers[api.Name]; ok {
+			apiHealth.CircuitState = breaker.State
+			if breaker.State != processor.BreakerClosed {
+				apiHealth.Status = "circuit_" + breaker.State
+				apiHealth.CircuitRetryAt = breaker.RetryAt.Format(time.RFC3339)
+			}
+		}
+
+		apis = append(apis, apiHealth)
 	}
 
 	health := HealthMetrics{
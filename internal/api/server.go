@@ -8,7 +8,9 @@ import (
 
 	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/alerts"
 	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/processor"
 	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/staleness"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/transport"
 	"github.com/sirupsen/logrus"
 )
 
@@ -20,8 +22,8 @@ type Server struct {
 }
 
 // NewServer creates a new metrics server
-func NewServer(port int, detector *staleness.Detector, alertManager *alerts.Manager, cfg *config.Config, logger *logrus.Logger) *Server {
-	handler := NewMetricsHandler(detector, alertManager, cfg, logger)
+func NewServer(port int, detector *staleness.Detector, transports *transport.Registry, fileProcessor *processor.FileProcessor, alertManager *alerts.Manager, cfg *config.Config, logger *logrus.Logger) *Server {
+	handler := NewMetricsHandler(detector, transports, fileProcessor, alertManager, cfg, logger)
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
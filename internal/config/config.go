@@ -1,14 +1,26 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net/url"
 	"os"
+	"path"
+	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/robfig/cron/v3"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 	"gopkg.in/yaml.v3"
 )
 
+// ValueTypes lists the column types supported by typed schemas
+var ValueTypes = []string{"string", "int", "float", "bool", "timestamp"}
+
 // Config represents the main configuration structure
 type Config struct {
 	Global   GlobalConfig   `yaml:"global"`
@@ -19,12 +31,14 @@ type Config struct {
 
 // GlobalConfig contains global application settings
 type GlobalConfig struct {
-	Name          string        `yaml:"name"`
-	Interval      time.Duration `yaml:"interval"`
-	LogLevel      string        `yaml:"log_level"`
-	EnableMetrics bool          `yaml:"enable_metrics"`
-	EnableAlerts  bool          `yaml:"enable_alerts"`
-	WorkerCount   int           `yaml:"worker_count"`
+	Name          string          `yaml:"name"`
+	Interval      time.Duration   `yaml:"interval"`
+	LogLevel      string          `yaml:"log_level"`
+	EnableMetrics bool            `yaml:"enable_metrics"`
+	EnableAlerts  bool            `yaml:"enable_alerts"`
+	WorkerCount   int             `yaml:"worker_count"`
+	RateLimit     RateLimitConfig `yaml:"rate_limit"` // default limits for every upstream host
+	StateDir      string          `yaml:"state_dir"`  // where state kept across restarts is stored
 }
 
 // NewRelicConfig contains New Relic integration settings
@@ -38,7 +52,8 @@ type NewRelicConfig struct {
 
 // AlertsConfig contains alert configuration
 type AlertsConfig struct {
-	Channels []AlertChannel `yaml:"channels"`
+	Channels   []AlertChannel    `yaml:"channels"`
+	Transforms []TransformConfig `yaml:"transforms"` // applied to alert metadata
 }
 
 // AlertChannel represents different alert delivery methods
@@ -59,15 +74,113 @@ type APIConfig struct {
 	Attributes  map[string]string `yaml:"attributes"`
 	EventType   string            `yaml:"event_type"`
 	Staleness   StalenessConfig   `yaml:"staleness"`
+	Flatten     FlattenConfig     `yaml:"flatten"`
+	Explode     *ExplodeConfig    `yaml:"explode"`
+	CSV         CSVConfig         `yaml:"csv"`
+	Prometheus  PrometheusConfig  `yaml:"prometheus"`
+	XML         XMLConfig         `yaml:"xml"`
+	Regex       RegexConfig       `yaml:"regex"`
+	Compression string            `yaml:"compression"` // auto, none, gzip, zstd, zip, tar
+	Archive     ArchiveConfig     `yaml:"archive"`
+	Request     RequestConfig     `yaml:"request"`
+	Auth        AuthConfig        `yaml:"auth"`
+	TLS         TLSConfig         `yaml:"tls"`
+	Pagination  PaginationConfig  `yaml:"pagination"`
+	Retry       RetryConfig       `yaml:"retry"`
+	Breaker     BreakerConfig     `yaml:"circuit_breaker"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"` // limits for this API's host, shared with other APIs on it
+	Limits      LimitsConfig      `yaml:"limits"`
+	Schema      SchemaConfig      `yaml:"schema"`
+	Dedupe      DedupeConfig      `yaml:"dedupe"`
+	Rates       RateConfig        `yaml:"rate_fields"`
+	Timestamp   TimestampConfig   `yaml:"timestamp_field"`
+	Enrich      []EnrichConfig    `yaml:"enrich"`
+	Derive      []DeriveConfig    `yaml:"derive"`
+	Transforms  []TransformConfig `yaml:"transforms"`
+	Schedule    ScheduleConfig    `yaml:"schedule"`
+	Deadline    time.Duration     `yaml:"deadline"` // limit for a whole run, including retries and pages
 	Enabled     bool              `yaml:"enabled"`
 }
 
 // StalenessConfig contains file staleness detection settings
 type StalenessConfig struct {
-	Enabled   bool          `yaml:"enabled"`
-	Threshold time.Duration `yaml:"threshold"`
-	Behavior  string        `yaml:"behavior"` // skip, alert, continue
-	CheckURL  string        `yaml:"check_url"`
+	Enabled    bool          `yaml:"enabled"`
+	Threshold  time.Duration `yaml:"threshold"`
+	Behavior   string        `yaml:"behavior"` // skip, alert, continue
+	CheckURL   string        `yaml:"check_url"`
+	Source     string        `yaml:"source"`      // last_modified, payload
+	UseRequest bool          `yaml:"use_request"` // reuse request headers, query and timeout for the probe
+}
+
+// RequestConfig customizes the HTTP request used to fetch an API.
+// Header and query values are expanded from the environment on each request.
+type RequestConfig struct {
+	Method   string            `yaml:"method"`
+	Headers  map[string]string `yaml:"headers"`
+	Body     string            `yaml:"body"`
+	BodyFile string            `yaml:"body_file"`
+	Query    map[string]string `yaml:"query"`
+	Timeout  time.Duration     `yaml:"timeout"`
+}
+
+// FlattenConfig controls how nested objects become dotted event attributes
+type FlattenConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Separator     string `yaml:"separator"`
+	MaxDepth      int    `yaml:"max_depth"`
+	Arrays        string `yaml:"arrays"` // index, join, drop
+	JoinSeparator string `yaml:"join_separator"`
+	MaxKeyLength  int    `yaml:"max_key_length"`
+}
+
+// ExplodeConfig splits an array inside each record into one sample per element.
+// Inherited parent fields are carried down to every element, including
+// through nested explode levels.
+type ExplodeConfig struct {
+	Path      string         `yaml:"path"`
+	Inherit   []string       `yaml:"inherit"`
+	OnMissing string         `yaml:"on_missing"` // keep (default) or drop records without the array
+	Explode   *ExplodeConfig `yaml:"explode"`
+}
+
+// CSVConfig contains CSV dialect and column type settings
+type CSVConfig struct {
+	Delimiter       string            `yaml:"delimiter"`
+	Comment         string            `yaml:"comment"` // "none" disables comment lines
+	Quotes          string            `yaml:"quotes"`  // strict, lazy, none
+	NoHeader        bool              `yaml:"no_header"`
+	Columns         []string          `yaml:"columns"`
+	SkipRows        int               `yaml:"skip_rows"`
+	Types           map[string]string `yaml:"types"`        // column -> string, int, float, bool, timestamp
+	DefaultType     string            `yaml:"default_type"` // auto, string
+	TimestampLayout string            `yaml:"timestamp_layout"`
+	Lenient         bool              `yaml:"lenient"`
+}
+
+// PrometheusConfig contains settings for the Prometheus text exposition format
+type PrometheusConfig struct {
+	Mode string `yaml:"mode"` // samples, metrics
+}
+
+// XMLConfig controls how XML documents are converted to generic maps
+type XMLConfig struct {
+	AttributePrefix string `yaml:"attribute_prefix"`
+	TextKey         string `yaml:"text_key"`
+}
+
+// RegexConfig contains settings for parsing plain-text logs with named capture groups
+type RegexConfig struct {
+	Pattern         string            `yaml:"pattern"`
+	RecordStart     string            `yaml:"record_start"` // lines matching this begin a new multi-line record
+	Types           map[string]string `yaml:"types"`        // group -> string, int, float, bool, timestamp
+	TimestampLayout string            `yaml:"timestamp_layout"`
+	Tail            bool              `yaml:"tail"`
+	StateDir        string            `yaml:"state_dir"` // tail offsets; defaults to global.state_dir
+}
+
+// ArchiveConfig selects which members of a zip or tar payload are processed
+type ArchiveConfig struct {
+	Members []string `yaml:"members"` // glob patterns, all regular files when empty
 }
 
 // LoadConfig loads configuration from file
@@ -112,6 +225,9 @@ func (c *Config) setDefaults() error {
 	if c.Global.WorkerCount == 0 {
 		c.Global.WorkerCount = 4
 	}
+	if c.Global.StateDir == "" {
+		c.Global.StateDir = "state"
+	}
 
 	// New Relic defaults
 	if c.NewRelic.Region == "" {
@@ -141,6 +257,163 @@ func (c *Config) setDefaults() error {
 		if api.EventType == "" {
 			api.EventType = "FlexSample"
 		}
+		if api.CSV.Delimiter == "" {
+			api.CSV.Delimiter = ","
+		}
+		if api.CSV.Comment == "" {
+			api.CSV.Comment = "#"
+		}
+		if api.CSV.Quotes == "" {
+			api.CSV.Quotes = "strict"
+		}
+		if api.CSV.DefaultType == "" {
+			api.CSV.DefaultType = "auto"
+		}
+		if api.CSV.TimestampLayout == "" {
+			api.CSV.TimestampLayout = time.RFC3339
+		}
+		if api.XML.AttributePrefix == "" {
+			api.XML.AttributePrefix = "@"
+		}
+		if api.XML.TextKey == "" {
+			api.XML.TextKey = "#text"
+		}
+		if api.Auth.Type == "" {
+			api.Auth.Type = "none"
+		}
+		if api.Pagination.Type == "" {
+			api.Pagination.Type = "none"
+		}
+		if api.Pagination.Type != "none" {
+			if api.Pagination.CursorParam == "" {
+				api.Pagination.CursorParam = "cursor"
+			}
+			if api.Pagination.OffsetParam == "" {
+				api.Pagination.OffsetParam = "offset"
+			}
+			if api.Pagination.PageParam == "" {
+				api.Pagination.PageParam = "page"
+			}
+			if api.Pagination.StartPage == 0 {
+				api.Pagination.StartPage = 1
+			}
+			if api.Pagination.LimitParam == "" {
+				api.Pagination.LimitParam = "limit"
+			}
+			if api.Pagination.Limit == 0 {
+				api.Pagination.Limit = 100
+			}
+			if api.Pagination.MaxPages == 0 {
+				api.Pagination.MaxPages = 10
+			}
+		}
+		if api.Retry.MaxAttempts == 0 {
+			api.Retry.MaxAttempts = 3
+		}
+		if api.Retry.BaseBackoff == 0 {
+			api.Retry.BaseBackoff = 500 * time.Millisecond
+		}
+		if api.Retry.MaxBackoff == 0 {
+			api.Retry.MaxBackoff = 30 * time.Second
+		}
+		if api.Retry.Jitter == 0 {
+			api.Retry.Jitter = 0.2
+		}
+		if api.Retry.RetryOnStatus == nil {
+			api.Retry.RetryOnStatus = []int{408, 429, 500, 502, 503, 504}
+		}
+		if api.Retry.RetryOnErrors == nil {
+			api.Retry.RetryOnErrors = []string{"timeout", "connection"}
+		}
+		if api.Limits.BodyBehavior == "" {
+			api.Limits.BodyBehavior = "error"
+		}
+		if api.Limits.RecordsBehavior == "" {
+			api.Limits.RecordsBehavior = "truncate"
+		}
+		if api.Dedupe.Enabled {
+			if api.Dedupe.TTL == 0 {
+				api.Dedupe.TTL = 24 * time.Hour
+			}
+			if api.Dedupe.StateDir == "" {
+				api.Dedupe.StateDir = c.Global.StateDir
+			}
+		}
+		if api.Schema.File != "" {
+			if api.Schema.Invalid == "" {
+				api.Schema.Invalid = "drop"
+			}
+			if api.Schema.Invalid == "quarantine" && api.Schema.QuarantineDir == "" {
+				api.Schema.QuarantineDir = "quarantine"
+			}
+		}
+		for j := range api.Enrich {
+			rule := &api.Enrich[j]
+			if rule.Key == "" {
+				rule.Key = rule.Field
+			}
+			if rule.OnMiss == "" {
+				rule.OnMiss = "default"
+			}
+		}
+		if api.Timestamp.Field != "" {
+			if api.Timestamp.Unit == "" {
+				api.Timestamp.Unit = "s"
+			}
+			if api.Timestamp.Timezone == "" {
+				api.Timestamp.Timezone = "UTC"
+			}
+		}
+		if api.Schedule.Interval == 0 && api.Schedule.Cron == "" {
+			api.Schedule.Interval = c.Global.Interval
+		}
+		// A hung source should not run into its next scheduled run
+		if api.Deadline == 0 && api.Schedule.Cron == "" {
+			api.Deadline = api.Schedule.Interval
+		}
+		if api.Breaker.Enabled {
+			if api.Breaker.FailureThreshold == 0 {
+				api.Breaker.FailureThreshold = 5
+			}
+			if api.Breaker.SuccessThreshold == 0 {
+				api.Breaker.SuccessThreshold = 1
+			}
+			if api.Breaker.CoolDown == 0 {
+				api.Breaker.CoolDown = 5 * time.Minute
+			}
+		}
+		if api.Request.Method == "" {
+			api.Request.Method = "GET"
+		}
+		if api.Compression == "" {
+			api.Compression = "auto"
+		}
+		if api.Regex.TimestampLayout == "" {
+			api.Regex.TimestampLayout = time.RFC3339
+		}
+		if api.Regex.Tail && api.Regex.StateDir == "" {
+			api.Regex.StateDir = c.Global.StateDir
+		}
+		if api.Prometheus.Mode == "" {
+			api.Prometheus.Mode = "samples"
+		}
+		if api.Flatten.Enabled {
+			if api.Flatten.Separator == "" {
+				api.Flatten.Separator = "."
+			}
+			if api.Flatten.MaxDepth == 0 {
+				api.Flatten.MaxDepth = 10
+			}
+			if api.Flatten.Arrays == "" {
+				api.Flatten.Arrays = "index"
+			}
+			if api.Flatten.JoinSeparator == "" {
+				api.Flatten.JoinSeparator = ","
+			}
+			if api.Flatten.MaxKeyLength == 0 {
+				api.Flatten.MaxKeyLength = 255
+			}
+		}
 		if !api.Staleness.Enabled {
 			continue
 		}
@@ -150,14 +423,54 @@ func (c *Config) setDefaults() error {
 		if api.Staleness.Behavior == "" {
 			api.Staleness.Behavior = "continue"
 		}
+		if api.Staleness.Source == "" {
+			api.Staleness.Source = "last_modified"
+		}
 		if api.Staleness.CheckURL == "" && api.URL != "" {
 			api.Staleness.CheckURL = api.URL
 		}
 	}
 
+	c.resolveRateLimits()
 	return nil
 }
 
+// resolveRateLimits gives every API the limits of its host. An API's own
+// rate_limit applies to all APIs on the same host; other hosts use the global
+// limits. Conflicting overrides are reported by validate.
+func (c *Config) resolveRateLimits() {
+	if c.Global.RateLimit.RequestsPerSecond > 0 && c.Global.RateLimit.Burst == 0 {
+		c.Global.RateLimit.Burst = 1
+	}
+
+	overrides := make(map[string]RateLimitConfig)
+	for i := range c.APIs {
+		limits := &c.APIs[i].RateLimit
+		if *limits == (RateLimitConfig{}) {
+			continue
+		}
+		if limits.RequestsPerSecond > 0 && limits.Burst == 0 {
+			limits.Burst = 1
+		}
+		host := HostOf(c.APIs[i].URL)
+		if _, ok := overrides[host]; !ok {
+			overrides[host] = *limits
+		}
+	}
+
+	for i := range c.APIs {
+		api := &c.APIs[i]
+		if api.RateLimit != (RateLimitConfig{}) {
+			continue
+		}
+		if limits, ok := overrides[HostOf(api.URL)]; ok {
+			api.RateLimit = limits
+		} else {
+			api.RateLimit = c.Global.RateLimit
+		}
+	}
+}
+
 // validate checks configuration for required fields and consistency
 func (c *Config) validate() error {
 	// Validate New Relic config
@@ -178,11 +491,17 @@ func (c *Config) validate() error {
 		return fmt.Errorf("worker_count must be between 1 and 100, got %d", c.Global.WorkerCount)
 	}
 
+	if err := validateRateLimit(c.Global.RateLimit); err != nil {
+		return fmt.Errorf("global.rate_limit: %w", err)
+	}
+
 	// Validate APIs
 	if len(c.APIs) == 0 {
 		return fmt.Errorf("at least one API configuration is required")
 	}
 
+	hostLimits := make(map[string]RateLimitConfig)
+
 	for i, api := range c.APIs {
 		if api.Name == "" {
 			return fmt.Errorf("api[%d].name is required", i)
@@ -191,11 +510,153 @@ func (c *Config) validate() error {
 			return fmt.Errorf("api[%d].url is required", i)
 		}
 
-		validFormats := []string{"json", "csv"}
+		validFormats := []string{"json", "csv", "prometheus", "xml", "yaml", "regex"}
 		if !contains(validFormats, strings.ToLower(api.Format)) {
 			return fmt.Errorf("api[%d].format must be one of %v, got %s", i, validFormats, api.Format)
 		}
 
+		if api.Flatten.Enabled {
+			validArrayModes := []string{"index", "join", "drop"}
+			if !contains(validArrayModes, strings.ToLower(api.Flatten.Arrays)) {
+				return fmt.Errorf("api[%d].flatten.arrays must be one of %v, got %s", i, validArrayModes, api.Flatten.Arrays)
+			}
+			if api.Flatten.MaxDepth < 1 {
+				return fmt.Errorf("api[%d].flatten.max_depth must be positive", i)
+			}
+			if api.Flatten.MaxKeyLength < 1 {
+				return fmt.Errorf("api[%d].flatten.max_key_length must be positive", i)
+			}
+		}
+
+		if strings.ToLower(api.Format) == "prometheus" {
+			validModes := []string{"samples", "metrics"}
+			if !contains(validModes, strings.ToLower(api.Prometheus.Mode)) {
+				return fmt.Errorf("api[%d].prometheus.mode must be one of %v, got %s", i, validModes, api.Prometheus.Mode)
+			}
+		}
+
+		if err := validateRequest(api.Request); err != nil {
+			return fmt.Errorf("api[%d].request: %w", i, err)
+		}
+
+		if err := validateAuth(api.Auth); err != nil {
+			return fmt.Errorf("api[%d].auth: %w", i, err)
+		}
+
+		if err := validateTLS(api.TLS); err != nil {
+			return fmt.Errorf("api[%d].tls: %w", i, err)
+		}
+
+		if err := validatePagination(api); err != nil {
+			return fmt.Errorf("api[%d].pagination: %w", i, err)
+		}
+
+		if err := validateRetry(api.Retry); err != nil {
+			return fmt.Errorf("api[%d].retry: %w", i, err)
+		}
+
+		if err := validateSchedule(api.Schedule); err != nil {
+			return fmt.Errorf("api[%d].schedule: %w", i, err)
+		}
+
+		if api.Deadline < 0 {
+			return fmt.Errorf("api[%d].deadline cannot be negative", i)
+		}
+
+		if err := validateLimits(api); err != nil {
+			return fmt.Errorf("api[%d].limits: %w", i, err)
+		}
+
+		if err := validateSchema(api.Schema); err != nil {
+			return fmt.Errorf("api[%d].schema: %w", i, err)
+		}
+
+		if api.Dedupe.Enabled && api.Dedupe.TTL < 0 {
+			return fmt.Errorf("api[%d].dedupe.ttl cannot be negative", i)
+		}
+
+		if api.Rates.Metrics && len(api.Rates.Fields) == 0 {
+			return fmt.Errorf("api[%d].rate_fields.metrics requires fields", i)
+		}
+
+		for j, rule := range api.Enrich {
+			if err := validateEnrich(rule); err != nil {
+				return fmt.Errorf("api[%d].enrich[%d]: %w", i, j, err)
+			}
+		}
+
+		names := make(map[string]bool)
+		for j, d := range api.Derive {
+			if d.Name == "" {
+				return fmt.Errorf("api[%d].derive[%d].name is required", i, j)
+			}
+			if names[d.Name] {
+				return fmt.Errorf("api[%d].derive has duplicate name %s", i, d.Name)
+			}
+			names[d.Name] = true
+
+			// Compile once here; processors reuse the program on every sample
+			program, err := compileDerive(d.Expr)
+			if err != nil {
+				return fmt.Errorf("api[%d].derive[%d]: invalid expression for %s: %w", i, j, d.Name, err)
+			}
+			c.APIs[i].Derive[j].program = program
+		}
+
+		for j := range api.Transforms {
+			if err := validateTransform(&c.APIs[i].Transforms[j]); err != nil {
+				return fmt.Errorf("api[%d].transforms[%d]: %w", i, j, err)
+			}
+		}
+
+		if err := validateTimestamp(api); err != nil {
+			return fmt.Errorf("api[%d].timestamp_field: %w", i, err)
+		}
+
+		if err := validateRateLimit(api.RateLimit); err != nil {
+			return fmt.Errorf("api[%d].rate_limit: %w", i, err)
+		}
+		host := HostOf(api.URL)
+		if limits, ok := hostLimits[host]; ok && limits != api.RateLimit {
+			return fmt.Errorf("api[%d].rate_limit conflicts with another API on host %s", i, host)
+		}
+		hostLimits[host] = api.RateLimit
+
+		if api.Breaker.Enabled && (api.Breaker.FailureThreshold < 1 || api.Breaker.SuccessThreshold < 1 || api.Breaker.CoolDown <= 0) {
+			return fmt.Errorf("api[%d].circuit_breaker: thresholds must be at least 1 and cool_down positive", i)
+		}
+
+		validCompressions := []string{"auto", "none", "gzip", "zstd", "zip", "tar"}
+		if !contains(validCompressions, strings.ToLower(api.Compression)) {
+			return fmt.Errorf("api[%d].compression must be one of %v, got %s", i, validCompressions, api.Compression)
+		}
+		for _, member := range api.Archive.Members {
+			if _, err := path.Match(member, ""); err != nil {
+				return fmt.Errorf("api[%d].archive.members has invalid pattern %q: %w", i, member, err)
+			}
+		}
+
+		if strings.ToLower(api.Format) == "regex" {
+			if err := validateRegex(api.Regex); err != nil {
+				return fmt.Errorf("api[%d].regex: %w", i, err)
+			}
+		}
+
+		if strings.ToLower(api.Format) == "csv" {
+			if err := validateCSV(api.CSV); err != nil {
+				return fmt.Errorf("api[%d].csv: %w", i, err)
+			}
+		}
+
+		for level, explode := 0, api.Explode; explode != nil; level, explode = level+1, explode.Explode {
+			if explode.Path == "" {
+				return fmt.Errorf("api[%d].explode.path is required (level %d)", i, level)
+			}
+			if explode.OnMissing != "" && !contains([]string{"keep", "drop"}, strings.ToLower(explode.OnMissing)) {
+				return fmt.Errorf("api[%d].explode.on_missing must be keep or drop, got %s (level %d)", i, explode.OnMissing, level)
+			}
+		}
+
 		if api.Staleness.Enabled {
 			validBehaviors := []string{"skip", "alert", "continue"}
 			if !contains(validBehaviors, strings.ToLower(api.Staleness.Behavior)) {
@@ -204,6 +665,13 @@ func (c *Config) validate() error {
 			if api.Staleness.Threshold <= 0 {
 				return fmt.Errorf("api[%d].staleness.threshold must be positive", i)
 			}
+			validSources := []string{"last_modified", "payload"}
+			if !contains(validSources, strings.ToLower(api.Staleness.Source)) {
+				return fmt.Errorf("api[%d].staleness.source must be one of %v, got %s", i, validSources, api.Staleness.Source)
+			}
+			if strings.ToLower(api.Staleness.Source) == "payload" && strings.ToLower(api.Format) != "prometheus" && !carriesEntryTimes(api.Compression, api.URL) {
+				return fmt.Errorf("api[%d].staleness.source payload requires sample timestamps (prometheus) or archive entry times (zip or tar)", i)
+			}
 		}
 	}
 
@@ -217,10 +685,661 @@ func (c *Config) validate() error {
 			return fmt.Errorf("alerts.channels[%d].type must be one of %v, got %s", i, validTypes, channel.Type)
 		}
 	}
+	for i := range c.Alerts.Transforms {
+		if err := validateTransform(&c.Alerts.Transforms[i]); err != nil {
+			return fmt.Errorf("alerts.transforms[%d]: %w", i, err)
+		}
+	}
 
 	return nil
 }
 
+// validateCSV checks CSV dialect and column type settings
+func validateCSV(c CSVConfig) error {
+	if utf8.RuneCountInString(c.Delimiter) != 1 || !validCSVRune(c.Delimiter) {
+		return fmt.Errorf("delimiter must be a single character other than a quote or line break, got %q", c.Delimiter)
+	}
+	if c.Comment != "none" {
+		if utf8.RuneCountInString(c.Comment) != 1 || !validCSVRune(c.Comment) {
+			return fmt.Errorf("comment must be a single character other than a quote or line break, or \"none\", got %q", c.Comment)
+		}
+		if c.Comment == c.Delimiter {
+			return fmt.Errorf("comment and delimiter must differ, both are %q", c.Delimiter)
+		}
+	}
+
+	validQuotes := []string{"strict", "lazy", "none"}
+	if !contains(validQuotes, strings.ToLower(c.Quotes)) {
+		return fmt.Errorf("quotes must be one of %v, got %s", validQuotes, c.Quotes)
+	}
+
+	if c.NoHeader && len(c.Columns) == 0 {
+		return fmt.Errorf("columns are required when no_header is set")
+	}
+	if c.SkipRows < 0 {
+		return fmt.Errorf("skip_rows cannot be negative")
+	}
+
+	validDefaultTypes := []string{"auto", "string"}
+	if !contains(validDefaultTypes, strings.ToLower(c.DefaultType)) {
+		return fmt.Errorf("default_type must be one of %v, got %s", validDefaultTypes, c.DefaultType)
+	}
+
+	for column, typ := range c.Types {
+		if !contains(ValueTypes, strings.ToLower(typ)) {
+			return fmt.Errorf("types.%s must be one of %v, got %s", column, ValueTypes, typ)
+		}
+	}
+
+	return nil
+}
+
+// validCSVRune reports whether the single character s can separate fields or
+// start comments; quotes and line breaks already have a meaning in CSV
+func validCSVRune(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r != '"' && r != '\r' && r != '\n' && r != 0 && r != utf8.RuneError
+}
+
+// validateRequest checks per-API request settings
+func validateRequest(r RequestConfig) error {
+	validMethods := []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+	if !contains(validMethods, strings.ToUpper(r.Method)) {
+		return fmt.Errorf("method must be one of %v, got %s", validMethods, r.Method)
+	}
+
+	if r.Body != "" && r.BodyFile != "" {
+		return fmt.Errorf("body and body_file are mutually exclusive")
+	}
+	if r.BodyFile != "" {
+		if _, err := os.Stat(r.BodyFile); err != nil {
+			return fmt.Errorf("body_file is not readable: %w", err)
+		}
+	}
+
+	if r.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+
+	return nil
+}
+
+// validateAuth checks that the fields required by the auth type are set
+func validateAuth(a AuthConfig) error {
+	switch strings.ToLower(a.Type) {
+	case "none":
+	case "basic":
+		if a.Username == "" {
+			return fmt.Errorf("username is required for basic auth")
+		}
+	case "bearer":
+		if a.Token == "" {
+			return fmt.Errorf("token is required for bearer auth")
+		}
+	case "oauth2":
+		if a.TokenURL == "" || a.ClientID == "" || a.ClientSecret == "" {
+			return fmt.Errorf("token_url, client_id and client_secret are required for oauth2")
+		}
+		if parsed, err := url.Parse(a.TokenURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("invalid token_url %q", a.TokenURL)
+		}
+	default:
+		return fmt.Errorf("type must be one of none, basic, bearer, oauth2, got %s", a.Type)
+	}
+	return nil
+}
+
+// validateTLS checks that TLS files exist and the minimum version is known
+func validateTLS(t TLSConfig) error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+
+	for _, file := range []string{t.CAFile, t.CertFile, t.KeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("cannot read %s: %w", file, err)
+		}
+	}
+
+	if t.MinVersion != "" {
+		if _, ok := TLSVersions[t.MinVersion]; !ok {
+			return fmt.Errorf("min_version must be one of 1.0, 1.1, 1.2, 1.3, got %s", t.MinVersion)
+		}
+	}
+
+	return nil
+}
+
+// validatePagination checks the pagination strategy and its limits
+func validatePagination(api APIConfig) error {
+	p := api.Pagination
+	validTypes := []string{"none", "link", "cursor", "offset", "page"}
+	if !contains(validTypes, strings.ToLower(p.Type)) {
+		return fmt.Errorf("type must be one of %v, got %s", validTypes, p.Type)
+	}
+	if strings.ToLower(p.Type) == "none" {
+		return nil
+	}
+
+	if strings.ToLower(api.Format) != "json" {
+		return fmt.Errorf("pagination is only supported for the json format")
+	}
+	if strings.ToLower(p.Type) == "cursor" && p.CursorQuery == "" {
+		return fmt.Errorf("cursor_query is required for cursor pagination")
+	}
+	if p.Limit < 0 || p.MaxPages < 0 || p.MaxRecords < 0 {
+		return fmt.Errorf("limit, max_pages and max_records cannot be negative")
+	}
+
+	return nil
+}
+
+// validateRetry checks the retry policy bounds
+func validateRetry(r RetryConfig) error {
+	if r.MaxAttempts < 1 {
+		return fmt.Errorf("max_attempts must be at least 1")
+	}
+	if r.BaseBackoff < 0 || r.MaxBackoff < r.BaseBackoff {
+		return fmt.Errorf("backoff must satisfy 0 <= base_backoff <= max_backoff")
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return fmt.Errorf("jitter must be between 0 and 1")
+	}
+	for _, status := range r.RetryOnStatus {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid retry status %d", status)
+		}
+	}
+	for _, class := range r.RetryOnErrors {
+		if !contains(RetryErrorClasses, class) {
+			return fmt.Errorf("retry_on_errors must contain only %v, got %s", RetryErrorClasses, class)
+		}
+	}
+	return nil
+}
+
+// validateLimits checks limit values and behaviors. Truncating a body only
+// makes sense for line-based formats, where the last partial line is dropped.
+func validateLimits(api APIConfig) error {
+	l := api.Limits
+	if l.MaxBodyBytes < 0 || l.MaxRecords < 0 {
+		return fmt.Errorf("max_body_bytes and max_records cannot be negative")
+	}
+	if !contains(LimitBehaviors, l.BodyBehavior) {
+		return fmt.Errorf("body_behavior must be one of %v, got %s", LimitBehaviors, l.BodyBehavior)
+	}
+	if !contains(LimitBehaviors, l.RecordsBehavior) {
+		return fmt.Errorf("records_behavior must be one of %v, got %s", LimitBehaviors, l.RecordsBehavior)
+	}
+	// A failing tail never moves its offset, so it would fail on the same lines forever
+	if l.MaxRecords > 0 && l.RecordsBehavior == "error" && strings.ToLower(api.Format) == "regex" && api.Regex.Tail {
+		return fmt.Errorf("records_behavior error cannot be used with regex.tail, use truncate or skip")
+	}
+	lineBased := []string{"csv", "prometheus", "regex"}
+	if l.MaxBodyBytes > 0 && l.BodyBehavior == "truncate" && !contains(lineBased, strings.ToLower(api.Format)) {
+		return fmt.Errorf("body_behavior truncate requires a line-based format %v, got %s", lineBased, api.Format)
+	}
+	return nil
+}
+
+// validateSchema checks the invalid record mode and that the schema compiles
+func validateSchema(s SchemaConfig) error {
+	if s.File == "" {
+		return nil
+	}
+	if !contains(SchemaModes, s.Invalid) {
+		return fmt.Errorf("invalid must be one of %v, got %s", SchemaModes, s.Invalid)
+	}
+	if _, err := jsonschema.Compile(s.File); err != nil {
+		return fmt.Errorf("failed to compile %s: %w", s.File, err)
+	}
+	return nil
+}
+
+// validateEnrich checks that a lookup rule names a field and a readable
+// CSV or JSON table
+func validateEnrich(e EnrichConfig) error {
+	if e.Field == "" || e.File == "" {
+		return fmt.Errorf("field and file are required")
+	}
+	if !contains(EnrichMissPolicies, e.OnMiss) {
+		return fmt.Errorf("on_miss must be one of %v, got %s", EnrichMissPolicies, e.OnMiss)
+	}
+	ext := strings.ToLower(path.Ext(e.File))
+	if ext != ".csv" && ext != ".json" {
+		return fmt.Errorf("file must be a .csv or .json table, got %s", e.File)
+	}
+	if _, err := os.Stat(e.File); err != nil {
+		return fmt.Errorf("failed to read lookup table: %w", err)
+	}
+	return nil
+}
+
+// validateTransform checks that a transform step has the settings its type
+// needs, and compiles its replace pattern
+func validateTransform(t *TransformConfig) error {
+	if !contains(TransformTypes, t.Type) {
+		return fmt.Errorf("type must be one of %v, got %s", TransformTypes, t.Type)
+	}
+	for _, field := range t.Fields {
+		if _, err := path.Match(field, ""); err != nil {
+			return fmt.Errorf("invalid field pattern %q: %w", field, err)
+		}
+	}
+
+	switch t.Type {
+	case "rename":
+		if t.Field == "" || t.To == "" {
+			return fmt.Errorf("rename requires field and to")
+		}
+	case "set":
+		if t.Field == "" {
+			return fmt.Errorf("set requires field")
+		}
+	case "drop", "keep":
+		if len(t.Fields) == 0 {
+			return fmt.Errorf("%s requires fields", t.Type)
+		}
+	case "replace":
+		// Compile once here; pipelines reuse the pattern on every run
+		pattern, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		t.pattern = pattern
+	case "hash":
+		if len(t.Fields) == 0 || t.Salt == "" {
+			return fmt.Errorf("hash requires fields and salt")
+		}
+	case "cast":
+		if len(t.Fields) == 0 || !contains(CastTypes, t.To) {
+			return fmt.Errorf("cast requires fields and to one of %v", CastTypes)
+		}
+	}
+	return nil
+}
+
+// validateTimestamp checks the unit and timezone of a timestamp field. Metrics
+// mode sends samples as dimensional metrics, which carry their own timestamps.
+func validateTimestamp(api APIConfig) error {
+	t := api.Timestamp
+	if t.Field == "" {
+		return nil
+	}
+	if !contains(TimestampUnits, t.Unit) {
+		return fmt.Errorf("unit must be one of %v, got %s", TimestampUnits, t.Unit)
+	}
+	if _, err := time.LoadLocation(t.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", t.Timezone, err)
+	}
+	if strings.ToLower(api.Format) == "prometheus" && strings.ToLower(api.Prometheus.Mode) == "metrics" {
+		return fmt.Errorf("not supported with prometheus metrics mode")
+	}
+	return nil
+}
+
+// validateRateLimit checks that limits are not negative
+func validateRateLimit(r RateLimitConfig) error {
+	if r.MaxConcurrency < 0 || r.RequestsPerSecond < 0 || r.Burst < 0 {
+		return fmt.Errorf("max_concurrency, requests_per_second and burst cannot be negative")
+	}
+	return nil
+}
+
+// validateSchedule checks that exactly one of interval or cron is usable
+func validateSchedule(s ScheduleConfig) error {
+	if s.Interval != 0 && s.Cron != "" {
+		return fmt.Errorf("interval and cron are mutually exclusive")
+	}
+	if s.Cron != "" {
+		if _, err := cron.ParseStandard(s.Cron); err != nil {
+			return fmt.Errorf("invalid cron expression %q: %w", s.Cron, err)
+		}
+	} else if s.Interval < time.Second {
+		return fmt.Errorf("interval must be at least 1s, got %v", s.Interval)
+	}
+	if s.Splay < 0 || s.InitialDelay < 0 {
+		return fmt.Errorf("splay and initial_delay cannot be negative")
+	}
+	return nil
+}
+
+// validateRegex checks that the log patterns compile and use named groups
+func validateRegex(r RegexConfig) error {
+	if r.Pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+
+	pattern, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	named := false
+	for _, name := range pattern.SubexpNames() {
+		if name != "" {
+			named = true
+			break
+		}
+	}
+	if !named {
+		return fmt.Errorf("pattern must contain at least one named capture group")
+	}
+
+	if r.RecordStart != "" {
+		if _, err := regexp.Compile(r.RecordStart); err != nil {
+			return fmt.Errorf("invalid record_start: %w", err)
+		}
+	}
+
+	for group, typ := range r.Types {
+		if !contains(ValueTypes, strings.ToLower(typ)) {
+			return fmt.Errorf("types.%s must be one of %v, got %s", group, ValueTypes, typ)
+		}
+	}
+
+	return nil
+}
+
+// AuthConfig configures authentication for an API source. Secret values are
+// expanded from the environment when they are used.
+type AuthConfig struct {
+	Type         string   `yaml:"type"` // none, basic, bearer, oauth2
+	Username     string   `yaml:"username"`
+	Password     string   `yaml:"password"`
+	Token        string   `yaml:"token"`
+	TokenURL     string   `yaml:"token_url"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// PaginationConfig controls how paginated JSON sources are followed. Records
+// from all pages are concatenated into one array before JQ and conversion.
+type PaginationConfig struct {
+	Type        string `yaml:"type"`         // none, link, cursor, offset, page
+	RecordsPath string `yaml:"records_path"` // dotted path to the records array in each page
+	CursorQuery string `yaml:"cursor_query"` // jq expression returning the next cursor or URL
+	CursorParam string `yaml:"cursor_param"`
+	OffsetParam string `yaml:"offset_param"`
+	PageParam   string `yaml:"page_param"`
+	StartPage   int    `yaml:"start_page"`
+	LimitParam  string `yaml:"limit_param"`
+	Limit       int    `yaml:"limit"` // page size for offset and page pagination
+	MaxPages    int    `yaml:"max_pages"`
+	MaxRecords  int    `yaml:"max_records"` // 0 means no limit
+}
+
+// RetryConfig controls retries of fetches and staleness probes for an API
+type RetryConfig struct {
+	MaxAttempts   int           `yaml:"max_attempts"` // total attempts including the first
+	BaseBackoff   time.Duration `yaml:"base_backoff"`
+	MaxBackoff    time.Duration `yaml:"max_backoff"` // also caps Retry-After
+	Jitter        float64       `yaml:"jitter"`      // fraction of the backoff to randomize, 0-1
+	RetryOnStatus []int         `yaml:"retry_on_status"`
+	RetryOnErrors []string      `yaml:"retry_on_errors"` // timeout, connection, dns
+	NonIdempotent bool          `yaml:"non_idempotent"`  // also retry methods other than GET, HEAD and OPTIONS
+}
+
+// RetryErrorClasses lists the transport error classes that can be retried
+var RetryErrorClasses = []string{"timeout", "connection", "dns"}
+
+// BreakerConfig configures the per-API circuit breaker. After FailureThreshold
+// consecutive fetch failures the circuit opens and the API is skipped until
+// CoolDown has passed; a trial fetch then decides whether it closes again.
+type BreakerConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	FailureThreshold int           `yaml:"failure_threshold"`
+	SuccessThreshold int           `yaml:"success_threshold"` // trial successes needed to close
+	CoolDown         time.Duration `yaml:"cool_down"`
+}
+
+// LimitsConfig guards against runaway sources. Zero disables a limit. The
+// behaviors decide what happens when a limit is exceeded: truncate keeps what
+// fits, skip drops the run without an error, and error fails the run.
+type LimitsConfig struct {
+	MaxBodyBytes    int64  `yaml:"max_body_bytes"` // applies to the response and to the decompressed payload
+	BodyBehavior    string `yaml:"body_behavior"`  // defaults to error
+	MaxRecords      int    `yaml:"max_records"`
+	RecordsBehavior string `yaml:"records_behavior"` // defaults to truncate
+}
+
+// LimitBehaviors lists the supported limit behaviors
+var LimitBehaviors = []string{"truncate", "skip", "error"}
+
+// SchemaConfig validates records against a JSON Schema after jq and before
+// they are sent. Records are checked as produced by the source, before
+// flattening and custom attributes are applied.
+type SchemaConfig struct {
+	File          string `yaml:"file"`
+	Invalid       string `yaml:"invalid"`        // drop, tag or quarantine; defaults to drop
+	QuarantineDir string `yaml:"quarantine_dir"` // one JSONL file per API; defaults to quarantine
+}
+
+// DedupeConfig suppresses records that were already sent. Records are
+// identified by Keys, or by a hash of the whole record when no keys are set;
+// a record is sent again when its content changes or it has not been seen
+// for TTL. State is kept in StateDir across restarts.
+type DedupeConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Keys     []string      `yaml:"keys"`
+	TTL      time.Duration `yaml:"ttl"`       // defaults to 24h
+	StateDir string        `yaml:"state_dir"` // defaults to global.state_dir
+}
+
+// RateConfig turns monotonically increasing counters into deltas and
+// per-second rates between runs. A series is identified by SeriesKeys, or by
+// all string fields when none are set.
+type RateConfig struct {
+	Fields     []string `yaml:"fields"`
+	SeriesKeys []string `yaml:"series_keys"`
+	Metrics    bool     `yaml:"metrics"` // also send deltas and rates as dimensional metrics
+}
+
+// TimestampConfig takes the event timestamp from a record field instead of
+// the ingestion time. Strings are parsed with Layout in Timezone; numbers, and
+// strings when no layout is set, are epoch values in Unit. Field names refer
+// to the sample after flattening.
+type TimestampConfig struct {
+	Field    string `yaml:"field"`
+	Layout   string `yaml:"layout"`   // Go time layout, e.g. 2006-01-02 15:04:05
+	Timezone string `yaml:"timezone"` // for layouts without a zone; defaults to UTC
+	Unit     string `yaml:"unit"`     // s, ms or ns; defaults to s
+}
+
+// EnrichConfig joins a sample field to a local lookup table and adds the
+// matching row's columns to the sample. Tables are CSV files with a header
+// row, or JSON objects keyed by the lookup key or arrays of objects, and are
+// reloaded when the file changes.
+type EnrichConfig struct {
+	Field    string            `yaml:"field"`    // sample field holding the lookup key, after flattening
+	File     string            `yaml:"file"`     // .csv or .json table
+	Key      string            `yaml:"key"`      // key column in the table; defaults to field
+	Columns  []string          `yaml:"columns"`  // columns to add; defaults to all but the key
+	Prefix   string            `yaml:"prefix"`   // prepended to added field names
+	OnMiss   string            `yaml:"on_miss"`  // default or drop; defaults to default
+	Defaults map[string]string `yaml:"defaults"` // column values added when the key is not found
+}
+
+// EnrichMissPolicies lists how samples without a lookup match are handled
+var EnrichMissPolicies = []string{"default", "drop"}
+
+// DeriveConfig computes a field from an expression evaluated per sample.
+// Sample fields are variables in the expression; keys that are not valid
+// identifiers, such as flattened names, are read as $env["http.status"].
+// Derivations run in order, so later expressions can use earlier results.
+// Fields vary per record, so syntax is checked at load but types are checked
+// when each record is evaluated.
+type DeriveConfig struct {
+	Name string `yaml:"name"`
+	Expr string `yaml:"expr"`
+
+	program *vm.Program
+}
+
+// Program returns the compiled expression. Configs built without LoadConfig
+// are compiled on each call.
+func (d DeriveConfig) Program() (*vm.Program, error) {
+	if d.program != nil {
+		return d.program, nil
+	}
+	return compileDerive(d.Expr)
+}
+
+// compileDerive compiles a derive expression. Fields missing from a sample
+// evaluate to nil instead of failing.
+func compileDerive(source string) (*vm.Program, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, fmt.Errorf("expr is required")
+	}
+	return expr.Compile(source, expr.AllowUndefinedVariables())
+}
+
+// TransformConfig is one step of a field transform pipeline. Steps run in
+// order on samples after conversion and flattening. Fields are path.Match
+// patterns against sample keys, such as "user.*".
+type TransformConfig struct {
+	Type        string      `yaml:"type"`        // rename, drop, keep, replace, hash, cast or set
+	Fields      []string    `yaml:"fields"`      // fields for drop, keep, replace, hash and cast; replace defaults to all strings
+	Field       string      `yaml:"field"`       // field for rename and set
+	To          string      `yaml:"to"`          // new name for rename, type for cast
+	Pattern     string      `yaml:"pattern"`     // regular expression for replace
+	Replacement string      `yaml:"replacement"` // may reference groups as $1
+	Salt        string      `yaml:"salt"`        // prepended to values before hashing
+	Value       interface{} `yaml:"value"`       // constant for set
+
+	pattern *regexp.Regexp
+}
+
+// Regexp returns the compiled replace pattern. Configs built without
+// LoadConfig are compiled on each call.
+func (t TransformConfig) Regexp() (*regexp.Regexp, error) {
+	if t.pattern != nil {
+		return t.pattern, nil
+	}
+	return regexp.Compile(t.Pattern)
+}
+
+// TransformTypes lists the supported transform steps
+var TransformTypes = []string{"rename", "drop", "keep", "replace", "hash", "cast", "set"}
+
+// CastTypes lists the types a cast transform can convert to
+var CastTypes = []string{"string", "int", "float", "bool"}
+
+// TimestampUnits lists the supported epoch units
+var TimestampUnits = []string{"s", "ms", "ns"}
+
+// New Relic drops events with timestamps outside these bounds
+const (
+	MaxTimestampAge  = 48 * time.Hour
+	MaxTimestampSkew = 10 * time.Minute
+)
+
+// SchemaModes lists how invalid records can be handled
+var SchemaModes = []string{"drop", "tag", "quarantine"}
+
+// RateLimitConfig limits the requests sent to one upstream host. Requests
+// beyond MaxConcurrency wait for a slot; RequestsPerSecond and Burst form a
+// token bucket. Zero disables a limit.
+type RateLimitConfig struct {
+	MaxConcurrency    int     `yaml:"max_concurrency"`
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"` // defaults to 1 when requests_per_second is set
+}
+
+// ScheduleConfig controls when an API is processed. APIs set either an
+// interval or a cron expression; without either they use the global interval.
+type ScheduleConfig struct {
+	Interval     time.Duration `yaml:"interval"`
+	Cron         string        `yaml:"cron"`  // standard 5-field expression or descriptor such as @hourly
+	Splay        time.Duration `yaml:"splay"` // random delay added before each run
+	InitialDelay time.Duration `yaml:"initial_delay"`
+}
+
+// TLSConfig configures TLS for an API source
+type TLSConfig struct {
+	CAFile     string `yaml:"ca_file"`
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	ServerName string `yaml:"server_name"`
+	MinVersion string `yaml:"min_version"` // 1.0, 1.1, 1.2, 1.3
+	Insecure   bool   `yaml:"insecure"`    // skip certificate verification
+}
+
+// TLSVersions maps the supported min_version values to crypto/tls constants
+var TLSVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ResolveHeaders returns the configured headers with environment variables expanded
+func (r RequestConfig) ResolveHeaders() map[string]string {
+	headers := make(map[string]string, len(r.Headers))
+	for name, value := range r.Headers {
+		headers[name] = os.ExpandEnv(value)
+	}
+	return headers
+}
+
+// ResolveURL adds the configured query parameters, with environment variables
+// expanded, to rawURL. Parameters already present in the URL are replaced.
+func (r RequestConfig) ResolveURL(rawURL string) (string, error) {
+	if len(r.Query) == 0 {
+		return rawURL, nil
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+
+	query := parsed.Query()
+	for name, value := range r.Query {
+		query.Set(name, os.ExpandEnv(value))
+	}
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String(), nil
+}
+
+// carriesEntryTimes reports whether a payload is a zip or tar archive, whose
+// entries have modification times. With auto, gzip or zstd compression the
+// URL must name an archive.
+func carriesEntryTimes(compression, rawURL string) bool {
+	switch strings.ToLower(compression) {
+	case "zip", "tar":
+		return true
+	case "none":
+		return false
+	}
+
+	name := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		name = u.Path
+	}
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tgz", ".tar.gz", ".tar.zst", ".tar.zstd"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// HostOf returns the lower-cased host and port of a URL, or "" if it has none
+func HostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
 // contains checks if a slice contains a string
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -175,6 +175,469 @@ func TestConfigValidation(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "request body and body_file together",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:    "test-api",
+						URL:     "https://example.com/search",
+						Format:  "json",
+						Enabled: true,
+						Request: RequestConfig{
+							Method:   "POST",
+							Body:     `{"q": "*"}`,
+							BodyFile: "query.json",
+						},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "oauth2 auth without client secret",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:    "test-api",
+						URL:     "https://example.com/test.json",
+						Format:  "json",
+						Enabled: true,
+						Auth: AuthConfig{
+							Type:     "oauth2",
+							TokenURL: "https://sso.example.com/token",
+							ClientID: "monitor",
+						},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "TLS client certificate without key",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:    "test-api",
+						URL:     "https://example.com/test.json",
+						Format:  "json",
+						Enabled: true,
+						TLS: TLSConfig{
+							CertFile: "client.pem",
+						},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "negative deadline",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:     "test-api",
+						URL:      "https://example.com/test.json",
+						Format:   "json",
+						Enabled:  true,
+						Deadline: -time.Second,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "conflicting rate limits on one host",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:      "first",
+						URL:       "https://example.com/a.json",
+						Format:    "json",
+						Enabled:   true,
+						RateLimit: RateLimitConfig{MaxConcurrency: 2},
+					},
+					{
+						Name:      "second",
+						URL:       "https://example.com/b.json",
+						Format:    "json",
+						Enabled:   true,
+						RateLimit: RateLimitConfig{MaxConcurrency: 4},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "body truncation for JSON",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:    "test-api",
+						URL:     "https://example.com/test.json",
+						Format:  "json",
+						Enabled: true,
+						Limits:  LimitsConfig{MaxBodyBytes: 1024, BodyBehavior: "truncate"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "missing schema file",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:    "test-api",
+						URL:     "https://example.com/test.json",
+						Format:  "json",
+						Enabled: true,
+						Schema:  SchemaConfig{File: "/nonexistent/schema.json"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "unknown timestamp timezone",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:      "test-api",
+						URL:       "https://example.com/test.json",
+						Format:    "json",
+						Enabled:   true,
+						Timestamp: TimestampConfig{Field: "time", Timezone: "Mars/Olympus"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "hash transform without salt",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:       "test-api",
+						URL:        "https://example.com/test.json",
+						Format:     "json",
+						Enabled:    true,
+						Transforms: []TransformConfig{{Type: "hash", Fields: []string{"email"}}},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid derive expression",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:    "test-api",
+						URL:     "https://example.com/test.json",
+						Format:  "json",
+						Enabled: true,
+						Derive:  []DeriveConfig{{Name: "error_rate", Expr: "errors / "}},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "missing lookup table",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:    "test-api",
+						URL:     "https://example.com/test.json",
+						Format:  "json",
+						Enabled: true,
+						Enrich:  []EnrichConfig{{Field: "service_id", File: "/nonexistent/owners.csv"}},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "payload staleness without timestamps",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:        "test-api",
+						URL:         "https://example.com/export.json",
+						Format:      "json",
+						Compression: "auto",
+						Enabled:     true,
+						Staleness:   StalenessConfig{Enabled: true, Threshold: time.Hour, Behavior: "skip", Source: "payload"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "payload staleness for archive URL",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:        "test-api",
+						URL:         "https://example.com/export.tar.gz?day=1",
+						Format:      "json",
+						Compression: "auto",
+						Enabled:     true,
+						Staleness:   StalenessConfig{Enabled: true, Threshold: time.Hour, Behavior: "skip", Source: "payload"},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "failing record limit on a tailed log",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:        "test-api",
+						URL:         "https://example.com/app.log",
+						Format:      "regex",
+						Compression: "none",
+						Enabled:     true,
+						Regex:       RegexConfig{Pattern: `^(?P<line>.*)$`, Tail: true},
+						Limits:      LimitsConfig{MaxRecords: 100, BodyBehavior: "error", RecordsBehavior: "error"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid explode on_missing",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:    "test-api",
+						URL:     "https://example.com/report.json",
+						Format:  "json",
+						Enabled: true,
+						Explode: &ExplodeConfig{
+							Path:    "regions",
+							Explode: &ExplodeConfig{Path: "hosts", OnMissing: "skip"},
+						},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "CSV comment same as delimiter",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:    "test-api",
+						URL:     "https://example.com/test.csv",
+						Format:  "csv",
+						Enabled: true,
+						CSV:     CSVConfig{Delimiter: "#"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "CSV quote as delimiter",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:    "test-api",
+						URL:     "https://example.com/test.csv",
+						Format:  "csv",
+						Enabled: true,
+						CSV:     CSVConfig{Delimiter: `"`},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "CSV line break as delimiter",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:    "test-api",
+						URL:     "https://example.com/test.csv",
+						Format:  "csv",
+						Enabled: true,
+						CSV:     CSVConfig{Delimiter: "\n"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid CSV column type",
+			config: Config{
+				Global: GlobalConfig{
+					LogLevel:    "info",
+					WorkerCount: 4,
+				},
+				NewRelic: NewRelicConfig{
+					APIKey:    "test-key",
+					AccountID: "123456",
+				},
+				APIs: []APIConfig{
+					{
+						Name:    "test-api",
+						URL:     "https://example.com/test.csv",
+						Format:  "csv",
+						Enabled: true,
+						CSV: CSVConfig{
+							Types: map[string]string{"zip": "zipcode"},
+						},
+					},
+				},
+			},
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -195,6 +658,51 @@ func TestConfigValidation(t *testing.T) {
 	}
 }
 
+func TestRateLimitResolution(t *testing.T) {
+	cfg := Config{
+		Global: GlobalConfig{
+			RateLimit: RateLimitConfig{RequestsPerSecond: 5},
+		},
+		APIs: []APIConfig{
+			{Name: "override", URL: "https://a.example.com/1.json", RateLimit: RateLimitConfig{MaxConcurrency: 1}},
+			{Name: "same-host", URL: "https://A.example.com/2.json"},
+			{Name: "other-host", URL: "https://b.example.com/3.json"},
+		},
+	}
+	cfg.setDefaults()
+
+	override := RateLimitConfig{MaxConcurrency: 1}
+	global := RateLimitConfig{RequestsPerSecond: 5, Burst: 1}
+	if cfg.APIs[1].RateLimit != override {
+		t.Errorf("Expected host override %+v, got %+v", override, cfg.APIs[1].RateLimit)
+	}
+	if cfg.APIs[2].RateLimit != global {
+		t.Errorf("Expected global limits %+v, got %+v", global, cfg.APIs[2].RateLimit)
+	}
+}
+
+func TestDeriveCompiledAtLoad(t *testing.T) {
+	cfg := Config{
+		NewRelic: NewRelicConfig{APIKey: "test-key", AccountID: "123456"},
+		APIs: []APIConfig{
+			{
+				Name:   "test-api",
+				URL:    "https://example.com/test.json",
+				Format: "json",
+				Derive: []DeriveConfig{{Name: "error_rate", Expr: "errors / total"}},
+			},
+		},
+	}
+	cfg.setDefaults()
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	if cfg.APIs[0].Derive[0].program == nil {
+		t.Error("Expected expression to be compiled during validation")
+	}
+}
+
 func TestGetEnabledAPIs(t *testing.T) {
 	config := Config{
 		APIs: []APIConfig{
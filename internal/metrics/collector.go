@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -21,6 +22,10 @@ type Collector struct {
 	metricBatch []Metric
 	batchMutex  sync.Mutex
 	stats       CollectorStats
+
+	// Callbacks waiting for the send of the events and metrics batched before them
+	eventsDone  []func(delivered bool)
+	metricsDone []func(delivered bool)
 }
 
 // CollectorStats tracks collector performance
@@ -63,7 +68,25 @@ func NewCollector(cfg config.NewRelicConfig, logger *logrus.Logger) *Collector {
 func (c *Collector) AddEvent(eventType string, attributes map[string]interface{}) {
 	c.batchMutex.Lock()
 	defer c.batchMutex.Unlock()
+	c.addEvent(eventType, attributes)
+}
+
+// AddEvents adds several events to the batch. onDone, when not nil, runs once
+// the send that carries them has finished and reports whether it delivered them.
+func (c *Collector) AddEvents(eventType string, events []map[string]interface{}, onDone func(delivered bool)) {
+	c.batchMutex.Lock()
+	defer c.batchMutex.Unlock()
+
+	for _, attributes := range events {
+		c.addEvent(eventType, attributes)
+	}
+	if onDone != nil {
+		c.eventsDone = append(c.eventsDone, onDone)
+	}
+}
 
+// addEvent appends an event to the batch; the caller holds batchMutex
+func (c *Collector) addEvent(eventType string, attributes map[string]interface{}) {
 	event := map[string]interface{}{
 		"eventType": eventType,
 		"timestamp": time.Now().Unix(),
@@ -91,7 +114,26 @@ func (c *Collector) AddEvent(eventType string, attributes map[string]interface{}
 func (c *Collector) AddMetric(name string, metricType string, value float64, attributes map[string]interface{}) {
 	c.batchMutex.Lock()
 	defer c.batchMutex.Unlock()
+	c.addMetric(name, metricType, value, attributes)
+}
+
+// AddMetrics adds several metrics to the batch, timestamped now. onDone, when
+// not nil, runs once the send that carries them has finished and reports
+// whether it delivered them.
+func (c *Collector) AddMetrics(metrics []Metric, onDone func(delivered bool)) {
+	c.batchMutex.Lock()
+	defer c.batchMutex.Unlock()
+
+	for _, m := range metrics {
+		c.addMetric(m.Name, m.Type, m.Value, m.Attributes)
+	}
+	if onDone != nil {
+		c.metricsDone = append(c.metricsDone, onDone)
+	}
+}
 
+// addMetric appends a metric to the batch; the caller holds batchMutex
+func (c *Collector) addMetric(name string, metricType string, value float64, attributes map[string]interface{}) {
 	metric := Metric{
 		Name:       name,
 		Type:       metricType,
@@ -120,16 +162,22 @@ func (c *Collector) AddMetric(name string, metricType string, value float64, att
 	}).Debug("Metric added to batch")
 }
 
-// SendEvents sends all batched events to New Relic
-func (c *Collector) SendEvents() error {
+// SendEvents sends all batched events to New Relic; the request is abandoned when ctx is done
+func (c *Collector) SendEvents(ctx context.Context) error {
 	c.batchMutex.Lock()
 	events := make([]map[string]interface{}, len(c.eventBatch))
 	copy(events, c.eventBatch)
 	c.eventBatch = c.eventBatch[:0] // Clear batch
+	done := c.eventsDone
+	c.eventsDone = nil
 	c.batchMutex.Unlock()
 
+	delivered := false
+	defer func() { runCallbacks(done, delivered) }()
+
 	if len(events) == 0 {
 		c.logger.Debug("No events to send")
+		delivered = true
 		return nil
 	}
 
@@ -141,7 +189,7 @@ func (c *Collector) SendEvents() error {
 		return fmt.Errorf("failed to marshal events: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", eventsURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", eventsURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		c.stats.EventsErrorCount++
 		return fmt.Errorf("failed to create events request: %w", err)
@@ -180,19 +228,26 @@ func (c *Collector) SendEvents() error {
 		"status":      resp.StatusCode,
 	}).Info("Events sent to New Relic successfully")
 
+	delivered = true
 	return nil
 }
 
-// SendMetrics sends all batched metrics to New Relic
-func (c *Collector) SendMetrics() error {
+// SendMetrics sends all batched metrics to New Relic; the request is abandoned when ctx is done
+func (c *Collector) SendMetrics(ctx context.Context) error {
 	c.batchMutex.Lock()
 	metrics := make([]Metric, len(c.metricBatch))
 	copy(metrics, c.metricBatch)
 	c.metricBatch = c.metricBatch[:0] // Clear batch
+	done := c.metricsDone
+	c.metricsDone = nil
 	c.batchMutex.Unlock()
 
+	delivered := false
+	defer func() { runCallbacks(done, delivered) }()
+
 	if len(metrics) == 0 {
 		c.logger.Debug("No metrics to send")
+		delivered = true
 		return nil
 	}
 
@@ -217,7 +272,7 @@ func (c *Collector) SendMetrics() error {
 		return fmt.Errorf("failed to marshal metrics: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", c.config.MetricsURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.MetricsURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		c.stats.MetricsErrorCount++
 		return fmt.Errorf("failed to create metrics request: %w", err)
@@ -256,18 +311,26 @@ func (c *Collector) SendMetrics() error {
 		"status":       resp.StatusCode,
 	}).Info("Metrics sent to New Relic successfully")
 
+	delivered = true
 	return nil
 }
 
+// runCallbacks runs the callbacks of a finished send
+func runCallbacks(callbacks []func(delivered bool), delivered bool) {
+	for _, fn := range callbacks {
+		fn(delivered)
+	}
+}
+
 // SendBatch sends both events and metrics
-func (c *Collector) SendBatch() error {
+func (c *Collector) SendBatch(ctx context.Context) error {
 	var errors []error
 
-	if err := c.SendEvents(); err != nil {
+	if err := c.SendEvents(ctx); err != nil {
 		errors = append(errors, fmt.Errorf("events: %w", err))
 	}
 
-	if err := c.SendMetrics(); err != nil {
+	if err := c.SendMetrics(ctx); err != nil {
 		errors = append(errors, fmt.Errorf("metrics: %w", err))
 	}
 
@@ -300,6 +363,103 @@ func (c *Collector) RecordProcessingMetrics(apiName string, duration time.Durati
 	c.AddMetric("flex.processing.status", "gauge", status, attributes)
 }
 
+// RecordFetchAttempts records how many HTTP attempts a request needed;
+// request is "fetch" for the data or "staleness" for the probe
+func (c *Collector) RecordFetchAttempts(apiName string, request string, attempts int, hasError bool) {
+	attributes := map[string]interface{}{
+		"api.name":  apiName,
+		"request":   request,
+		"has_error": hasError,
+	}
+
+	c.AddMetric("flex.fetch.attempts", "gauge", float64(attempts), attributes)
+	c.AddMetric("flex.fetch.retries", "count", float64(attempts-1), attributes)
+}
+
+// RecordBreakerState records an API's circuit breaker state as 0 (closed),
+// 0.5 (half-open) or 1 (open)
+func (c *Collector) RecordBreakerState(apiName string, state string) {
+	value := 0.0
+	switch state {
+	case "half-open":
+		value = 0.5
+	case "open":
+		value = 1.0
+	}
+
+	c.AddMetric("flex.circuit_breaker.state", "gauge", value, map[string]interface{}{
+		"api.name": apiName,
+		"state":    state,
+	})
+}
+
+// RecordPageMetrics records the latency and record count of a fetched page
+func (c *Collector) RecordPageMetrics(apiName string, page int, latency time.Duration, recordCount int) {
+	attributes := map[string]interface{}{
+		"api.name": apiName,
+		"page":     page,
+	}
+
+	c.AddMetric("flex.pagination.page_latency", "gauge", latency.Seconds(), attributes)
+	c.AddMetric("flex.pagination.page_records", "gauge", float64(recordCount), attributes)
+}
+
+// RecordCounterRate sends a counter's delta and per-second rate as
+// dimensional metrics named after the counter field
+func (c *Collector) RecordCounterRate(apiName string, field string, delta float64, rate float64, attributes map[string]interface{}) {
+	attrs := make(map[string]interface{}, len(attributes)+1)
+	for k, v := range attributes {
+		attrs[k] = v
+	}
+	attrs["api.name"] = apiName
+
+	c.AddMetric(field+".delta", "count", delta, attrs)
+	c.AddMetric(field+".rate", "gauge", rate, attrs)
+}
+
+// RecordRejectedTimestamps counts records dropped for timestamps outside the
+// window New Relic accepts
+func (c *Collector) RecordRejectedTimestamps(apiName string, rejected int) {
+	c.AddMetric("flex.timestamp.rejected", "count", float64(rejected), map[string]interface{}{
+		"api.name": apiName,
+	})
+}
+
+// RecordDuplicates counts records suppressed as already sent
+func (c *Collector) RecordDuplicates(apiName string, suppressed int) {
+	c.AddMetric("flex.dedupe.suppressed", "count", float64(suppressed), map[string]interface{}{
+		"api.name": apiName,
+	})
+}
+
+// RecordValidation records how many records passed and failed schema validation
+func (c *Collector) RecordValidation(apiName string, valid int, invalid int) {
+	attributes := map[string]interface{}{
+		"api.name": apiName,
+	}
+
+	c.AddMetric("flex.validation.valid", "count", float64(valid), attributes)
+	c.AddMetric("flex.validation.invalid", "count", float64(invalid), attributes)
+}
+
+// RecordLimitExceeded counts an API exceeding its response size or record limit
+func (c *Collector) RecordLimitExceeded(apiName string, limit string, behavior string) {
+	c.AddMetric("flex.limit.exceeded", "count", 1, map[string]interface{}{
+		"api.name": apiName,
+		"limit":    limit,
+		"behavior": behavior,
+	})
+}
+
+// RecordLimiterWait records how long a request waited for a host's
+// concurrency slot and rate limit token
+func (c *Collector) RecordLimiterWait(apiName string, host string, wait time.Duration) {
+	c.AddMetric("flex.ratelimit.wait", "gauge", wait.Seconds(), map[string]interface{}{
+		"api.name": apiName,
+		"host":     host,
+	})
+}
+
 // RecordStalenessMetrics records staleness detection metrics
 func (c *Collector) RecordStalenessMetrics(apiName string, fileAge time.Duration, threshold time.Duration, isStale bool) {
 	attributes := map[string]interface{}{
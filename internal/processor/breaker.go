@@ -0,0 +1,159 @@
+package processor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// BreakerStatus is a snapshot of an API's circuit breaker
+type BreakerStatus struct {
+	State               string
+	ConsecutiveFailures int
+	OpenedAt            time.Time
+	RetryAt             time.Time // when an open circuit allows a trial fetch
+}
+
+// circuitBreaker tracks consecutive fetch failures for one API
+type circuitBreaker struct {
+	mutex     sync.Mutex
+	cfg       config.BreakerConfig
+	state     string
+	failures  int
+	successes int
+	openedAt  time.Time
+	trial     bool // a half-open trial fetch is in flight
+}
+
+// allow reports whether a fetch may proceed. An open circuit moves to
+// half-open once the cool-down has passed and admits a single trial fetch.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < b.cfg.CoolDown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.successes = 0
+		b.trial = true
+		return true
+	case BreakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of a fetch
+func (b *circuitBreaker) record(success bool, now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.trial = false
+	if success {
+		b.failures = 0
+		if b.state == BreakerHalfOpen {
+			b.successes++
+			if b.successes >= b.cfg.SuccessThreshold {
+				b.state = BreakerClosed
+			}
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.state = BreakerOpen
+		b.openedAt = now
+	}
+}
+
+// release frees a half-open trial that ended without reaching the fetch,
+// for example when the API was skipped as stale
+func (b *circuitBreaker) release() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.trial = false
+}
+
+// status returns a snapshot of the breaker
+func (b *circuitBreaker) status() BreakerStatus {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	status := BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state != BreakerClosed {
+		status.OpenedAt = b.openedAt
+		status.RetryAt = b.openedAt.Add(b.cfg.CoolDown)
+	}
+	return status
+}
+
+// breakerFor returns the circuit breaker for an API, or nil when disabled
+func (fp *FileProcessor) breakerFor(api config.APIConfig) *circuitBreaker {
+	if !api.Breaker.Enabled {
+		return nil
+	}
+
+	fp.breakerMutex.Lock()
+	defer fp.breakerMutex.Unlock()
+
+	breaker, ok := fp.breakers[api.Name]
+	if !ok {
+		breaker = &circuitBreaker{cfg: api.Breaker, state: BreakerClosed}
+		fp.breakers[api.Name] = breaker
+	}
+	return breaker
+}
+
+// recordBreaker records a fetch outcome and logs circuit state changes
+func (fp *FileProcessor) recordBreaker(api config.APIConfig, breaker *circuitBreaker, success bool) {
+	if breaker == nil {
+		return
+	}
+
+	before := breaker.status().State
+	breaker.record(success, time.Now())
+	after := breaker.status()
+
+	fp.metricsCollector.RecordBreakerState(api.Name, after.State)
+	if before != after.State {
+		fp.logger.WithFields(logrus.Fields{
+			"api":      api.Name,
+			"from":     before,
+			"to":       after.State,
+			"failures": after.ConsecutiveFailures,
+		}).Warn("Circuit breaker state changed")
+	}
+}
+
+// BreakerStates returns the circuit breaker state of every API that has one
+func (fp *FileProcessor) BreakerStates() map[string]BreakerStatus {
+	fp.breakerMutex.Lock()
+	defer fp.breakerMutex.Unlock()
+
+	states := make(map[string]BreakerStatus, len(fp.breakers))
+	for name, breaker := range fp.breakers {
+		states[name] = breaker.status()
+	}
+	return states
+}
@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// convertValue converts a raw text value to the given schema type.
+// The "auto" type guesses numbers and booleans and falls back to strings.
+func convertValue(value, typ, timestampLayout string) (interface{}, error) {
+	switch strings.ToLower(typ) {
+	case "string":
+		return value, nil
+	case "int":
+		return strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	case "float":
+		return strconv.ParseFloat(strings.TrimSpace(value), 64)
+	case "bool":
+		return strconv.ParseBool(strings.TrimSpace(value))
+	case "timestamp":
+		t, err := time.Parse(timestampLayout, strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		return t.Unix(), nil
+	case "", "auto":
+		return inferValue(value), nil
+	default:
+		return nil, fmt.Errorf("unsupported value type: %s", typ)
+	}
+}
+
+// inferValue converts a value to a number or boolean if possible
+func inferValue(value string) interface{} {
+	if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+		return floatVal
+	}
+	if intVal, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return intVal
+	}
+	if boolVal, err := strconv.ParseBool(value); err == nil {
+		return boolVal
+	}
+	return value
+}
@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"encoding/csv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+)
+
+// readCSVRecords parses CSV content with the configured delimiter, comment
+// character and quote handling. Rows may have differing column counts.
+func readCSVRecords(content string, opts config.CSVConfig) ([][]string, error) {
+	delimiter, _ := utf8.DecodeRuneInString(opts.Delimiter)
+	var comment rune
+	if opts.Comment != "none" {
+		comment, _ = utf8.DecodeRuneInString(opts.Comment)
+	}
+
+	if strings.ToLower(opts.Quotes) == "none" {
+		return splitCSVLines(content, opts.Delimiter, comment), nil
+	}
+
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.Comma = delimiter
+	reader.Comment = comment
+	reader.LazyQuotes = strings.ToLower(opts.Quotes) == "lazy"
+	reader.FieldsPerRecord = -1
+
+	return reader.ReadAll()
+}
+
+// splitCSVLines splits content on the delimiter without any quote processing
+func splitCSVLines(content, delimiter string, comment rune) [][]string {
+	var records [][]string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		if comment != 0 && strings.HasPrefix(line, string(comment)) {
+			continue
+		}
+		records = append(records, strings.Split(line, delimiter))
+	}
+	return records
+}
+
+// skipLines drops the first n lines of content
+func skipLines(content string, n int) string {
+	for i := 0; i < n && content != ""; i++ {
+		idx := strings.IndexByte(content, '\n')
+		if idx < 0 {
+			return ""
+		}
+		content = content[idx+1:]
+	}
+	return content
+}
+
+// csvColumnType returns the schema type for a column, falling back to the default type
+func csvColumnType(opts config.CSVConfig, column string) string {
+	if typ, ok := opts.Types[column]; ok {
+		return typ
+	}
+	return opts.DefaultType
+}
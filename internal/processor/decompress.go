@@ -0,0 +1,258 @@
+package processor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+)
+
+// payloadMember is a single document extracted from a fetched payload. Plain
+// and compressed payloads yield one unnamed member; archives yield one member
+// per selected entry.
+type payloadMember struct {
+	Name    string
+	ModTime time.Time
+	Data    []byte
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// decodePayload decompresses a payload and unpacks archives. The compression
+// is taken from the API config, or detected from the URL extension and the
+// payload's magic bytes when set to auto. max_body_bytes also applies to the
+// decompressed size: a larger payload returns a *limitError, and with the
+// truncate behavior the members that fit are returned with it.
+func decodePayload(data []byte, api config.APIConfig) ([]payloadMember, bool, error) {
+	kind := strings.ToLower(api.Compression)
+	if kind == "auto" {
+		kind = detectCompression(data, api.URL)
+	}
+
+	var limitErr error
+	switch kind {
+	case "gzip":
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		defer reader.Close()
+		if data, err = readDecompressed(reader, api.Limits); err != nil {
+			if !errors.As(err, new(*limitError)) {
+				return nil, false, fmt.Errorf("failed to decompress gzip: %w", err)
+			}
+			limitErr = err
+		}
+	case "zstd":
+		decoder, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+		defer decoder.Close()
+		if data, err = readDecompressed(decoder, api.Limits); err != nil {
+			if !errors.As(err, new(*limitError)) {
+				return nil, false, fmt.Errorf("failed to decompress zstd: %w", err)
+			}
+			limitErr = err
+		}
+	case "zip":
+		members, err := unpackZip(data, api.Archive.Members, api.Limits)
+		return members, true, err
+	case "tar":
+		members, err := unpackTar(data, api.Archive.Members, false)
+		return members, true, err
+	case "none":
+		return []payloadMember{{Data: data}}, false, nil
+	default:
+		return nil, false, fmt.Errorf("unsupported compression: %s", kind)
+	}
+	if limitErr != nil && data == nil {
+		return nil, false, limitErr
+	}
+
+	// Compressed tarballs (.tar.gz, .tgz, .tar.zst). The decompressed size
+	// bounds the members, so only a truncated stream needs care.
+	if isTar(data) {
+		members, err := unpackTar(data, api.Archive.Members, limitErr != nil)
+		if err != nil {
+			return nil, true, err
+		}
+		return members, true, limitErr
+	}
+
+	return []payloadMember{{Data: data}}, false, limitErr
+}
+
+// readDecompressed reads a decompressed stream of at most max_body_bytes,
+// like readBody does for response bodies
+func readDecompressed(r io.Reader, limits config.LimitsConfig) ([]byte, error) {
+	data, err := io.ReadAll(limitReader(r, limits.MaxBodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	return limitBytes(data, limits.MaxBodyBytes, 0, limits.BodyBehavior)
+}
+
+// detectCompression guesses the compression from the URL extension and the
+// payload's magic bytes. The magic bytes win when they contradict the
+// extension, e.g. when a transport already decoded a gzip Content-Encoding.
+func detectCompression(data []byte, rawURL string) string {
+	name := rawURL
+	if parsed, err := url.Parse(rawURL); err == nil {
+		name = parsed.Path
+	}
+	name = strings.ToLower(name)
+
+	magic := "none"
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		magic = "gzip"
+	case bytes.HasPrefix(data, zstdMagic):
+		magic = "zstd"
+	case bytes.HasPrefix(data, zipMagic):
+		magic = "zip"
+	case isTar(data):
+		magic = "tar"
+	}
+
+	extension := "none"
+	switch {
+	case strings.HasSuffix(name, ".gz"), strings.HasSuffix(name, ".tgz"):
+		extension = "gzip"
+	case strings.HasSuffix(name, ".zst"), strings.HasSuffix(name, ".zstd"):
+		extension = "zstd"
+	case strings.HasSuffix(name, ".zip"):
+		extension = "zip"
+	case strings.HasSuffix(name, ".tar"):
+		extension = "tar"
+	}
+
+	if extension != "none" && (magic == extension || magic == "none" && extension == "tar") {
+		return extension
+	}
+	return magic
+}
+
+// isTar reports whether data starts with a POSIX tar header
+func isTar(data []byte) bool {
+	return len(data) >= 262 && bytes.Equal(data[257:262], []byte("ustar"))
+}
+
+// unpackZip extracts the zip entries matching the member patterns. The
+// decompressed size of the selected entries counts against max_body_bytes.
+func unpackZip(data []byte, patterns []string, limits config.LimitsConfig) ([]payloadMember, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip archive: %w", err)
+	}
+
+	var members []payloadMember
+	remaining := limits.MaxBodyBytes
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() || !matchesMember(file.Name, patterns) {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open zip member %s: %w", file.Name, err)
+		}
+		var r io.Reader = rc
+		if limits.MaxBodyBytes > 0 {
+			r = io.LimitReader(rc, remaining+1)
+		}
+		content, err := io.ReadAll(r)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zip member %s: %w", file.Name, err)
+		}
+
+		member := payloadMember{
+			Name:    file.Name,
+			ModTime: file.Modified,
+			Data:    content,
+		}
+		if limits.MaxBodyBytes > 0 && int64(len(content)) > remaining {
+			hit := &limitError{hit: LimitHit{Limit: "max_body_bytes", Max: limits.MaxBodyBytes, Behavior: limits.BodyBehavior}}
+			if limits.BodyBehavior != "truncate" {
+				return nil, hit
+			}
+			content = content[:remaining]
+			member.Data = content[:bytes.LastIndexByte(content, '\n')+1]
+			return append(members, member), hit
+		}
+		remaining -= int64(len(content))
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// unpackTar extracts the regular tar entries matching the member patterns.
+// A truncated archive ends at the cut, keeping the complete lines of the
+// member it falls in.
+func unpackTar(data []byte, patterns []string, truncated bool) ([]payloadMember, error) {
+	reader := tar.NewReader(bytes.NewReader(data))
+
+	var members []payloadMember
+	for {
+		header, err := reader.Next()
+		if err == io.EOF || truncated && err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg || !matchesMember(header.Name, patterns) {
+			continue
+		}
+
+		content, err := io.ReadAll(reader)
+		if truncated && err == io.ErrUnexpectedEOF {
+			content = content[:bytes.LastIndexByte(content, '\n')+1]
+			err = nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar member %s: %w", header.Name, err)
+		}
+
+		members = append(members, payloadMember{
+			Name:    header.Name,
+			ModTime: header.ModTime,
+			Data:    content,
+		})
+	}
+
+	return members, nil
+}
+
+// matchesMember reports whether an archive entry matches any glob pattern,
+// either by its full path or its base name
+func matchesMember(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// dedupeEntry is the last sent version of a record
+type dedupeEntry struct {
+	Hash string    `json:"hash"`
+	Seen time.Time `json:"seen"`
+}
+
+// dedupeStore remembers the records sent for one API, persisted as JSON.
+// Records queued for New Relic are pending until the flush that carries them
+// has finished, so later runs before that flush still suppress them.
+type dedupeStore struct {
+	mutex   sync.Mutex
+	path    string
+	entries map[string]dedupeEntry
+	pending map[string]dedupeEntry
+}
+
+// dedupeBatch is the pending entries added by one run, in sample order
+type dedupeBatch struct {
+	keys    []string
+	entries []dedupeEntry
+}
+
+// dedupeStoreFor returns the store for an API, loading its state on first use
+func (fp *FileProcessor) dedupeStoreFor(api config.APIConfig) *dedupeStore {
+	fp.dedupeMutex.Lock()
+	defer fp.dedupeMutex.Unlock()
+
+	if store, ok := fp.dedupeStores[api.Name]; ok {
+		return store
+	}
+
+	store := &dedupeStore{
+		path:    filepath.Join(api.Dedupe.StateDir, "dedupe", unsafeFileChars.ReplaceAllString(api.Name, "_")+".json"),
+		entries: make(map[string]dedupeEntry),
+		pending: make(map[string]dedupeEntry),
+	}
+	if err := store.load(); err != nil {
+		fp.logger.WithError(err).WithField("api", api.Name).Warn("Failed to load dedupe state, starting empty")
+	}
+	fp.dedupeStores[api.Name] = store
+	return store
+}
+
+// dedupeSamples drops samples that were already sent or queued unchanged
+// within the TTL, including repeats inside the same payload. Seeing a
+// duplicate again keeps its entry alive. The fresh samples are marked
+// pending; the returned batch must be settled with settleDedupe.
+func (fp *FileProcessor) dedupeSamples(api config.APIConfig, samples []map[string]interface{}, result *ProcessResult) ([]map[string]interface{}, *dedupeBatch) {
+	store := fp.dedupeStoreFor(api)
+	now := time.Now()
+	batch := &dedupeBatch{}
+
+	store.mutex.Lock()
+	fresh := make([]map[string]interface{}, 0, len(samples))
+	for _, sample := range samples {
+		key, hash := recordIdentity(sample, api.Dedupe.Keys)
+		if pending, ok := store.pending[key]; ok && pending.Hash == hash {
+			result.Duplicates++
+			continue
+		}
+		entry, ok := store.entries[key]
+		if ok && entry.Hash == hash && now.Sub(entry.Seen) < api.Dedupe.TTL {
+			store.entries[key] = dedupeEntry{Hash: hash, Seen: now}
+			result.Duplicates++
+			continue
+		}
+
+		entry = dedupeEntry{Hash: hash, Seen: now}
+		store.pending[key] = entry
+		batch.keys = append(batch.keys, key)
+		batch.entries = append(batch.entries, entry)
+		fresh = append(fresh, sample)
+	}
+	store.mutex.Unlock()
+
+	fp.metricsCollector.RecordDuplicates(api.Name, result.Duplicates)
+	if result.Duplicates > 0 {
+		fp.logger.WithFields(logrus.Fields{
+			"api":        api.Name,
+			"suppressed": result.Duplicates,
+			"fresh":      len(fresh),
+		}).Debug("Suppressed duplicate records")
+	}
+	return fresh, batch
+}
+
+// split keeps the first n entries of the batch and returns the rest
+func (b *dedupeBatch) split(n int) *dedupeBatch {
+	rest := &dedupeBatch{keys: b.keys[n:], entries: b.entries[n:]}
+	b.keys, b.entries = b.keys[:n], b.entries[:n]
+	return rest
+}
+
+// settleDedupe resolves the pending entries of a batch. Delivered entries
+// are remembered and the state is saved; otherwise they are dropped so the
+// records are sent again on the next run.
+func (fp *FileProcessor) settleDedupe(api config.APIConfig, batch *dedupeBatch, delivered bool) {
+	store := fp.dedupeStoreFor(api)
+	now := time.Now()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for i := range batch.keys {
+		key, entry := batch.keys[i], batch.entries[i]
+		// A later run may have queued a changed version of the record
+		if store.pending[key] == entry {
+			delete(store.pending, key)
+		}
+		if delivered {
+			store.entries[key] = entry
+		}
+	}
+	if !delivered {
+		return
+	}
+
+	for key, entry := range store.entries {
+		if now.Sub(entry.Seen) >= api.Dedupe.TTL {
+			delete(store.entries, key)
+		}
+	}
+
+	if err := store.save(); err != nil {
+		fp.logger.WithError(err).WithField("api", api.Name).Error("Failed to save dedupe state")
+	}
+}
+
+// recordIdentity returns the key identifying a sample and a hash of its
+// content. The processing timestamp differs on every run and is ignored.
+func recordIdentity(sample map[string]interface{}, keys []string) (string, string) {
+	content := make(map[string]interface{}, len(sample))
+	for k, v := range sample {
+		if k != "processed.timestamp" {
+			content[k] = v
+		}
+	}
+	// fmt prints map keys in sorted order, so the hash is stable
+	hash := hashString(fmt.Sprint(content))
+
+	if len(keys) == 0 {
+		return hash, hash
+	}
+
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		values[i] = fmt.Sprint(sample[k])
+	}
+	return hashString(strings.Join(values, "\x1f")), hash
+}
+
+// hashString returns the hex SHA-256 of s
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// load reads the persisted state; a missing file is an empty state
+func (s *dedupeStore) load() error {
+	return readStateFile(s.path, &s.entries)
+}
+
+// save writes the state atomically so a crash never leaves a partial file
+func (s *dedupeStore) save() error {
+	return writeStateFile(s.path, s.entries)
+}
@@ -0,0 +1,56 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/expr-lang/expr"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// applyDerive evaluates the API's derive expressions on each sample in order
+// and stores the results. An expression that fails, such as an operation on a
+// missing field or mismatched types, leaves the field unset for that sample,
+// as does a nil result. NaN and infinite results, e.g. from dividing by zero,
+// are counted as failures since they cannot be encoded for New Relic.
+func (fp *FileProcessor) applyDerive(api config.APIConfig, samples []map[string]interface{}) error {
+	if len(api.Derive) == 0 {
+		return nil
+	}
+
+	for _, d := range api.Derive {
+		program, err := d.Program()
+		if err != nil {
+			return fmt.Errorf("invalid expression for %s: %w", d.Name, err)
+		}
+
+		failed := 0
+		var lastErr error
+		for _, sample := range samples {
+			value, err := expr.Run(program, sample)
+			if err != nil {
+				failed++
+				lastErr = err
+				continue
+			}
+			if f, ok := value.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+				failed++
+				lastErr = fmt.Errorf("result is %v", f)
+				continue
+			}
+			if value != nil {
+				sample[d.Name] = value
+			}
+		}
+
+		if failed > 0 {
+			fp.logger.WithError(lastErr).WithFields(logrus.Fields{
+				"api":    api.Name,
+				"field":  d.Name,
+				"failed": failed,
+			}).Warn("Derived field could not be evaluated for some records")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// processXML converts an XML document to a generic map and runs it through
+// the regular JQ and conversion pipeline
+func (fp *FileProcessor) processXML(data []byte, api config.APIConfig, fetchedAt time.Time) ([]map[string]interface{}, error) {
+	rawData, err := decodeXML(data, api.XML)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse XML: %w", err)
+	}
+
+	return fp.processDocument(rawData, api, fetchedAt)
+}
+
+// processYAML decodes a YAML document (or a stream of documents) and runs it
+// through the regular JQ and conversion pipeline
+func (fp *FileProcessor) processYAML(data []byte, api config.APIConfig, fetchedAt time.Time) ([]map[string]interface{}, error) {
+	rawData, err := decodeYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+
+	return fp.processDocument(rawData, api, fetchedAt)
+}
+
+// decodeXML converts an XML document into nested maps. Attributes are stored
+// with the configured prefix, repeated elements become arrays, and elements
+// holding only text become strings. The result is keyed by the root element.
+func decodeXML(data []byte, cfg config.XMLConfig) (interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("document has no root element")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			root, err := decodeXMLElement(decoder, start, cfg)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{start.Name.Local: root}, nil
+		}
+	}
+}
+
+// decodeXMLElement decodes the children of start up to its matching end element
+func decodeXMLElement(decoder *xml.Decoder, start xml.StartElement, cfg config.XMLConfig) (interface{}, error) {
+	fields := make(map[string]interface{})
+	for _, attr := range start.Attr {
+		fields[cfg.AttributePrefix+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLElement(decoder, t, cfg)
+			if err != nil {
+				return nil, err
+			}
+			addXMLChild(fields, t.Name.Local, child)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			content := strings.TrimSpace(text.String())
+			if len(fields) == 0 {
+				return content, nil
+			}
+			if content != "" {
+				fields[cfg.TextKey] = content
+			}
+			return fields, nil
+		}
+	}
+}
+
+// addXMLChild stores a child element, turning repeated elements into arrays
+func addXMLChild(fields map[string]interface{}, name string, child interface{}) {
+	existing, ok := fields[name]
+	if !ok {
+		fields[name] = child
+		return
+	}
+
+	if list, ok := existing.([]interface{}); ok {
+		fields[name] = append(list, child)
+	} else {
+		fields[name] = []interface{}{existing, child}
+	}
+}
+
+// decodeYAML decodes one or more YAML documents into JSON-compatible values.
+// A stream with several documents is returned as an array.
+func decodeYAML(data []byte) (interface{}, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+
+	var documents []interface{}
+	for {
+		var doc interface{}
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, normalizeYAML(doc))
+	}
+
+	switch len(documents) {
+	case 0:
+		return nil, fmt.Errorf("empty document")
+	case 1:
+		return documents[0], nil
+	default:
+		return documents, nil
+	}
+}
+
+// normalizeYAML converts YAML-specific values (non-string keys, timestamps)
+// into the types used by JSON so JQ and sample conversion can handle them
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = normalizeYAML(child)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[fmt.Sprint(k)] = normalizeYAML(child)
+		}
+		return m
+	case []interface{}:
+		for i, child := range v {
+			v[i] = normalizeYAML(child)
+		}
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,169 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// lookupTable is a loaded enrichment table, keyed by the lookup key
+type lookupTable struct {
+	modTime time.Time
+	size    int64
+	rows    map[string]map[string]interface{}
+}
+
+// loadLookupTables loads or refreshes the API's lookup tables. A table is
+// reloaded when its file's modification time or size changes; if a reload
+// fails the previous version stays in use.
+func (fp *FileProcessor) loadLookupTables(api config.APIConfig) error {
+	for _, rule := range api.Enrich {
+		info, err := os.Stat(rule.File)
+
+		fp.tableMutex.Lock()
+		cacheKey := rule.File + "\x00" + rule.Key
+		current := fp.tables[cacheKey]
+		fp.tableMutex.Unlock()
+
+		if err != nil {
+			if current == nil {
+				return fmt.Errorf("failed to read lookup table: %w", err)
+			}
+			fp.logger.WithError(err).WithField("file", rule.File).Warn("Lookup table unavailable, using previous version")
+			continue
+		}
+		if current != nil && current.modTime.Equal(info.ModTime()) && current.size == info.Size() {
+			continue
+		}
+
+		rows, err := readLookupTable(rule.File, rule.Key)
+		if err != nil {
+			if current == nil {
+				return err
+			}
+			fp.logger.WithError(err).WithField("file", rule.File).Warn("Failed to reload lookup table, using previous version")
+			continue
+		}
+
+		fp.tableMutex.Lock()
+		fp.tables[cacheKey] = &lookupTable{modTime: info.ModTime(), size: info.Size(), rows: rows}
+		fp.tableMutex.Unlock()
+
+		fp.logger.WithFields(logrus.Fields{
+			"api":  api.Name,
+			"file": rule.File,
+			"rows": len(rows),
+		}).Info("Loaded lookup table")
+	}
+	return nil
+}
+
+// enrichSample adds lookup table columns to a sample and reports whether
+// the sample should be kept. Tables must have been loaded with
+// loadLookupTables.
+func (fp *FileProcessor) enrichSample(sample map[string]interface{}, api config.APIConfig) bool {
+	for _, rule := range api.Enrich {
+		fp.tableMutex.Lock()
+		table := fp.tables[rule.File+"\x00"+rule.Key]
+		fp.tableMutex.Unlock()
+
+		var row map[string]interface{}
+		if value, ok := sample[rule.Field]; ok && value != nil && table != nil {
+			row = table.rows[scalarString(value)]
+		}
+
+		if row == nil {
+			if rule.OnMiss == "drop" {
+				return false
+			}
+			for column, value := range rule.Defaults {
+				sample[rule.Prefix+column] = value
+			}
+			continue
+		}
+
+		for column, value := range row {
+			if column == rule.Key || (len(rule.Columns) > 0 && !containsString(rule.Columns, column)) {
+				continue
+			}
+			sample[rule.Prefix+column] = value
+		}
+	}
+	return true
+}
+
+// readLookupTable reads a CSV table with a header row, or a JSON table that
+// is either an object of rows keyed by the lookup key or an array of rows
+// holding a key column
+func readLookupTable(file, key string) (map[string]map[string]interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lookup table: %w", err)
+	}
+
+	rows := make(map[string]map[string]interface{})
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		if len(records) == 0 {
+			return rows, nil
+		}
+
+		header := records[0]
+		keyIndex := -1
+		for i, column := range header {
+			if column == key {
+				keyIndex = i
+			}
+		}
+		if keyIndex < 0 {
+			return nil, fmt.Errorf("%s has no %s column", file, key)
+		}
+
+		for _, record := range records[1:] {
+			row := make(map[string]interface{}, len(header))
+			for i, column := range header {
+				row[column] = record[i]
+			}
+			rows[record[keyIndex]] = row
+		}
+	case ".json":
+		var doc interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			for k, item := range v {
+				if row, ok := item.(map[string]interface{}); ok {
+					rows[k] = row
+				}
+			}
+		case []interface{}:
+			for _, item := range v {
+				row, ok := item.(map[string]interface{})
+				if !ok || row[key] == nil {
+					continue
+				}
+				rows[scalarString(row[key])] = row
+			}
+		default:
+			return nil, fmt.Errorf("%s must hold an object or an array of objects", file)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported lookup table format: %s", file)
+	}
+	return rows, nil
+}
@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"strings"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+)
+
+// explodeRecords splits every record on the configured array path, returning
+// one record per array element with the inherited parent fields merged in.
+// Records where the path is missing or not an array are kept unchanged, or
+// dropped with on_missing: drop; the number of such records is returned.
+func explodeRecords(data interface{}, cfg *config.ExplodeConfig) (interface{}, int) {
+	var records []interface{}
+	switch v := data.(type) {
+	case []interface{}:
+		records = v
+	case map[string]interface{}:
+		records = []interface{}{v}
+	default:
+		return data, 0
+	}
+
+	exploded := make([]interface{}, 0, len(records))
+	missing := 0
+	for _, record := range records {
+		recordMap, ok := record.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, row := range explodeRecord(recordMap, cfg, nil, &missing) {
+			exploded = append(exploded, row)
+		}
+	}
+
+	return exploded, missing
+}
+
+// explodeRecord expands a single record, recursing into nested explode
+// levels, and counts records without the array in missing
+func explodeRecord(record map[string]interface{}, cfg *config.ExplodeConfig, carried map[string]interface{}, missing *int) []map[string]interface{} {
+	inherited := make(map[string]interface{}, len(carried)+len(cfg.Inherit))
+	for k, v := range carried {
+		inherited[k] = v
+	}
+	for _, field := range cfg.Inherit {
+		if v, ok := lookupPath(record, field); ok {
+			inherited[field] = v
+		}
+	}
+
+	value, _ := lookupPath(record, cfg.Path)
+	items, ok := value.([]interface{})
+	if !ok {
+		*missing++
+		if strings.EqualFold(cfg.OnMissing, "drop") {
+			return nil
+		}
+		row := make(map[string]interface{}, len(inherited)+len(record))
+		for k, v := range inherited {
+			row[k] = v
+		}
+		for k, v := range record {
+			row[k] = v
+		}
+		return []map[string]interface{}{row}
+	}
+
+	var rows []map[string]interface{}
+	for _, item := range items {
+		row := make(map[string]interface{}, len(inherited))
+		for k, v := range inherited {
+			row[k] = v
+		}
+
+		// Element fields take precedence over inherited parent fields
+		if itemMap, ok := item.(map[string]interface{}); ok {
+			for k, v := range itemMap {
+				row[k] = v
+			}
+		} else {
+			row["value"] = item
+		}
+
+		if cfg.Explode != nil {
+			rows = append(rows, explodeRecord(row, cfg.Explode, inherited, missing)...)
+		} else {
+			rows = append(rows, row)
+		}
+	}
+
+	return rows
+}
+
+// lookupPath resolves a dotted path such as "report.rows" within a record
+func lookupPath(record map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = record
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -1,19 +1,22 @@
 package processor
 
 import (
-	"encoding/csv"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/itchyny/gojq"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
 	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/metrics"
 	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/staleness"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/transform"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/transport"
 	"github.com/sirupsen/logrus"
 )
 
@@ -23,10 +26,24 @@ type FileProcessor struct {
 	logger           *logrus.Logger
 	metricsCollector *metrics.Collector
 	stalenessDetector *staleness.Detector
+	transports        *transport.Registry
+	tailOffsets       map[string]int64
+	tailHeld          map[string]int64
+	tailMutex         sync.Mutex
+	breakers          map[string]*circuitBreaker
+	breakerMutex      sync.Mutex
+	schemas           map[string]*jsonschema.Schema
+	schemaMutex       sync.Mutex
+	dedupeStores      map[string]*dedupeStore
+	dedupeMutex       sync.Mutex
+	counters          map[string]map[string]counterState
+	rateMutex         sync.Mutex
+	tables            map[string]*lookupTable
+	tableMutex        sync.Mutex
 }
 
 // NewFileProcessor creates a new file processor
-func NewFileProcessor(logger *logrus.Logger, metricsCollector *metrics.Collector, stalenessDetector *staleness.Detector) *FileProcessor {
+func NewFileProcessor(logger *logrus.Logger, metricsCollector *metrics.Collector, stalenessDetector *staleness.Detector, transports *transport.Registry) *FileProcessor {
 	return &FileProcessor{
 		client: &http.Client{
 			Timeout: 60 * time.Second,
@@ -34,159 +51,534 @@ func NewFileProcessor(logger *logrus.Logger, metricsCollector *metrics.Collector
 		logger:            logger,
 		metricsCollector:  metricsCollector,
 		stalenessDetector: stalenessDetector,
+		transports:        transports,
+		tailOffsets:       make(map[string]int64),
+		tailHeld:          make(map[string]int64),
+		breakers:          make(map[string]*circuitBreaker),
+		schemas:           make(map[string]*jsonschema.Schema),
+		dedupeStores:      make(map[string]*dedupeStore),
+		counters:          make(map[string]map[string]counterState),
+		tables:            make(map[string]*lookupTable),
 	}
 }
 
 // ProcessResult represents the result of file processing
 type ProcessResult struct {
-	APIName     string
-	RecordCount int
-	Duration    time.Duration
-	IsStale     bool
-	HasError    bool
-	Error       error
-	Samples     []map[string]interface{}
+	APIName            string
+	RecordCount        int
+	Duration           time.Duration
+	IsStale            bool
+	HasError           bool
+	Error              error
+	Attempts           int        // HTTP attempts made to fetch the data, including retries
+	ProbeAttempts      int        // HTTP attempts made by the staleness probe, including retries
+	CircuitOpen        bool       // skipped without fetching because the circuit breaker is open
+	Cancelled          bool       // stopped because ctx was cancelled, e.g. on shutdown; not an error
+	TimedOut           bool       // stopped by the API's deadline; also reported as an error
+	Limits             []LimitHit // response size or record limits exceeded, in the order hit
+	InvalidRecords     int        // records that failed schema validation
+	Duplicates         int        // records suppressed as already sent
+	RejectedTimestamps int        // records dropped for timestamps New Relic would reject
+	Samples            []map[string]interface{}
 }
 
-// ProcessAPI processes a single API configuration
-func (fp *FileProcessor) ProcessAPI(api config.APIConfig) *ProcessResult {
+// ProcessAPI processes a single API configuration. Requests are bound to ctx
+// and to the API's deadline, if any.
+func (fp *FileProcessor) ProcessAPI(ctx context.Context, api config.APIConfig) *ProcessResult {
 	start := time.Now()
 	result := &ProcessResult{
 		APIName: api.Name,
 	}
 
-	fp.logger.WithField("api", api.Name).Info("Starting API processing")
+	if api.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, api.Deadline)
+		defer cancel()
+	}
 
-	// Check staleness if enabled
-	if api.Staleness.Enabled {
-		stalenessResult := fp.stalenessDetector.CheckStaleness(
-			api.Staleness.CheckURL,
-			api.Staleness.Threshold,
-			api.Staleness.Behavior,
-		)
+	fp.logger.WithField("api", api.Name).Info("Starting API processing")
 
-		result.IsStale = stalenessResult.IsStale
+	// Skip sources whose circuit is open instead of waiting on them again
+	breaker := fp.breakerFor(api)
+	if breaker != nil {
+		if !breaker.allow(time.Now()) {
+			status := breaker.status()
+			result.CircuitOpen = true
+			fp.metricsCollector.RecordBreakerState(api.Name, status.State)
+			fp.logger.WithFields(logrus.Fields{
+				"api":      api.Name,
+				"state":    status.State,
+				"retry_at": status.RetryAt,
+			}).Info("Circuit breaker open, skipping API")
+			return result
+		}
+		defer breaker.release()
+	}
 
-		if stalenessResult.Error != nil {
-			result.Error = fmt.Errorf("staleness check failed: %w", stalenessResult.Error)
+	// Check staleness if enabled
+	if api.Staleness.Enabled && !strings.EqualFold(api.Staleness.Source, "payload") {
+		client, err := fp.transports.Client(api)
+		if err != nil {
+			result.Error = err
 			result.HasError = true
 			fp.recordMetrics(result, time.Since(start))
 			return result
 		}
 
-		// Record staleness metrics
-		fp.metricsCollector.RecordStalenessMetrics(
-			api.Name,
-			stalenessResult.FileAge,
-			stalenessResult.Threshold,
-			stalenessResult.IsStale,
-		)
+		check := staleness.NewCheck(api)
+		check.Client = client
+		stalenessResult := fp.stalenessDetector.Check(ctx, check)
+		result.ProbeAttempts = stalenessResult.Attempts
+		stop := fp.handleStaleness(api, stalenessResult, result)
+		// After handleStaleness, so a cancelled probe is not reported as an error
+		if stalenessResult.Error != nil {
+			markContextDone(ctx, result)
+			if !result.Cancelled {
+				fp.recordBreaker(api, breaker, false)
+			}
+		}
+
+		if stop {
+			fp.recordMetrics(result, time.Since(start))
+			return result
+		}
+	}
 
-		// Handle staleness behavior
-		if result.IsStale && stalenessResult.ShouldSkip {
-			fp.logger.WithField("api", api.Name).Info("Skipping processing due to stale file")
+	// Compile the schema up front so a broken schema fails the run
+	if api.Schema.File != "" {
+		if _, err := fp.schemaFor(api); err != nil {
+			result.Error = err
+			result.HasError = true
 			fp.recordMetrics(result, time.Since(start))
 			return result
 		}
 	}
 
+	// Load lookup tables, picking up edited files
+	if err := fp.loadLookupTables(api); err != nil {
+		result.Error = err
+		result.HasError = true
+		fp.recordMetrics(result, time.Since(start))
+		return result
+	}
+
 	// Fetch and process data
-	data, err := fp.fetchData(api.URL)
-	if err != nil {
+	tailing := strings.ToLower(api.Format) == "regex" && api.Regex.Tail
+	var data []byte
+	var err error
+	var nextOffset int64
+	if tailing {
+		data, nextOffset, result.Attempts, err = fp.fetchTail(ctx, api)
+	} else if strings.ToLower(api.Pagination.Type) != "none" && api.Pagination.Type != "" {
+		data, result.Attempts, err = fp.fetchPages(ctx, api)
+	} else {
+		data, result.Attempts, err = fp.fetchData(ctx, api)
+	}
+
+	// An oversized response comes from a healthy source, so it does not
+	// count against the circuit breaker
+	var limitErr *limitError
+	if errors.As(err, &limitErr) {
+		fp.recordLimit(api, result, limitErr.hit)
+		if limitErr.hit.Behavior == "truncate" {
+			err = nil
+		}
+	}
+	if err != nil && (limitErr == nil || limitErr.hit.Behavior == "error") {
 		result.Error = fmt.Errorf("failed to fetch data: %w", err)
 		result.HasError = true
+		markContextDone(ctx, result)
+	}
+	// A cancelled fetch says nothing about the health of the source
+	if !result.Cancelled {
+		fp.recordBreaker(api, breaker, err == nil || limitErr != nil)
+	}
+	if err != nil {
 		fp.recordMetrics(result, time.Since(start))
 		return result
 	}
+	fetchedAt := time.Now()
 
-	// Process data based on format
+	// A tailed log is cut after max_records log records and the offset only
+	// advances past them, so truncated records are read on the next cycle
+	tailCut := tailing && api.Limits.MaxRecords > 0 && api.Limits.RecordsBehavior == "truncate"
+	if tailCut {
+		kept, records, err := cutTailRecords(data, api.Limits.MaxRecords, api)
+		if err != nil {
+			result.Error = fmt.Errorf("failed to process data: %w", err)
+			result.HasError = true
+			fp.recordMetrics(result, time.Since(start))
+			return result
+		}
+		if len(kept) < len(data) {
+			fp.recordLimit(api, result, LimitHit{
+				Limit:    "max_records",
+				Max:      int64(api.Limits.MaxRecords),
+				Observed: int64(records),
+				Behavior: api.Limits.RecordsBehavior,
+			})
+			nextOffset -= int64(len(data) - len(kept))
+			data = kept
+		}
+	}
+
+	// Decompress and unpack the payload unless tailing raw log bytes
+	members := []payloadMember{{Data: data}}
+	archive := false
+	if !tailing {
+		members, archive, err = decodePayload(data, api)
+		// max_body_bytes also applies to the decompressed size
+		var limitErr *limitError
+		if errors.As(err, &limitErr) {
+			fp.recordLimit(api, result, limitErr.hit)
+			switch limitErr.hit.Behavior {
+			case "truncate":
+				err = nil
+			case "skip":
+				fp.recordMetrics(result, time.Since(start))
+				return result
+			}
+		}
+		if err != nil {
+			result.Error = fmt.Errorf("failed to decompress data: %w", err)
+			result.HasError = true
+			fp.recordMetrics(result, time.Since(start))
+			return result
+		}
+	}
+
+	// Process each payload member based on format
 	var samples []map[string]interface{}
-	switch strings.ToLower(api.Format) {
-	case "json":
-		samples, err = fp.processJSON(data, api)
-	case "csv":
-		samples, err = fp.processCSV(data, api)
-	default:
-		err = fmt.Errorf("unsupported format: %s", api.Format)
+	var payloadTime time.Time
+	for _, member := range members {
+		if archive && api.Staleness.Enabled && strings.EqualFold(api.Staleness.Source, "payload") {
+			if fp.skipStaleMember(api, member, result) {
+				continue
+			}
+		}
+
+		memberSamples, memberTime, err := fp.processFormat(member.Data, api, fetchedAt)
+		if err != nil {
+			if archive {
+				err = fmt.Errorf("archive member %s: %w", member.Name, err)
+			}
+			result.Error = fmt.Errorf("failed to process data: %w", err)
+			result.HasError = true
+			fp.recordMetrics(result, time.Since(start))
+			return result
+		}
+
+		if archive {
+			for _, sample := range memberSamples {
+				sample["archive.member"] = member.Name
+			}
+		}
+		if memberTime.After(payloadTime) {
+			payloadTime = memberTime
+		}
+		samples = append(samples, memberSamples...)
 	}
 
-	if err != nil {
-		result.Error = fmt.Errorf("failed to process data: %w", err)
+	// Check staleness against timestamps carried in the payload
+	if !archive && api.Staleness.Enabled && strings.EqualFold(api.Staleness.Source, "payload") {
+		// Without timestamps freshness is unknown, so the data is not
+		// assumed to be fresh
+		if payloadTime.IsZero() {
+			result.Error = fmt.Errorf("staleness source payload: payload has no timestamps")
+			result.HasError = true
+			fp.recordMetrics(result, time.Since(start))
+			return result
+		}
+
+		stalenessResult := fp.stalenessDetector.Evaluate(
+			api.URL,
+			payloadTime,
+			api.Staleness.Threshold,
+			api.Staleness.Behavior,
+		)
+
+		if fp.handleStaleness(api, stalenessResult, result) {
+			fp.recordMetrics(result, time.Since(start))
+			return result
+		}
+	}
+
+	samples = fp.applySchema(api, samples, result)
+	if err := fp.applyDerive(api, samples); err != nil {
+		result.Error = fmt.Errorf("failed to derive fields: %w", err)
 		result.HasError = true
 		fp.recordMetrics(result, time.Since(start))
 		return result
 	}
+	if err := fp.applyTransforms(api, samples); err != nil {
+		result.Error = fmt.Errorf("failed to transform data: %w", err)
+		result.HasError = true
+		fp.recordMetrics(result, time.Since(start))
+		return result
+	}
+	samples = fp.applyTimestamps(api, samples, result, fetchedAt)
+	fp.applyRates(api, samples, fetchedAt)
+	var dedupe *dedupeBatch
+	if api.Dedupe.Enabled {
+		samples, dedupe = fp.dedupeSamples(api, samples, result)
+	}
+
+	if max := api.Limits.MaxRecords; max > 0 && len(samples) > max && !tailCut {
+		hit := LimitHit{
+			Limit:    "max_records",
+			Max:      int64(max),
+			Observed: int64(len(samples)),
+			Behavior: api.Limits.RecordsBehavior,
+		}
+		fp.recordLimit(api, result, hit)
+
+		// Records that are not sent must not stay pending
+		if dedupe != nil {
+			fp.settleDedupe(api, dedupe.split(max), false)
+			if api.Limits.RecordsBehavior != "truncate" {
+				fp.settleDedupe(api, dedupe, false)
+			}
+		}
+
+		switch api.Limits.RecordsBehavior {
+		case "truncate":
+			samples = samples[:max]
+		case "skip":
+			// Dropped on purpose, so tailing moves past these lines
+			if tailing {
+				fp.setTailOffset(api, nextOffset)
+			}
+			fp.recordMetrics(result, time.Since(start))
+			return result
+		default:
+			result.Error = &limitError{hit: hit}
+			result.HasError = true
+			fp.recordMetrics(result, time.Since(start))
+			return result
+		}
+	}
 
 	result.Samples = samples
 	result.RecordCount = len(samples)
 	result.Duration = time.Since(start)
 
+	// Dedupe state is saved once New Relic has accepted the samples, so
+	// records lost with a failed flush are sent again
+	var onDone func(bool)
+	if dedupe != nil {
+		onDone = func(delivered bool) { fp.settleDedupe(api, dedupe, delivered) }
+	}
+
 	// Send samples to New Relic
-	fp.sendSamplesToNewRelic(samples, api.EventType)
+	if strings.ToLower(api.Format) == "prometheus" && api.Prometheus.Mode == "metrics" {
+		fp.sendSamplesAsMetrics(samples, onDone)
+	} else {
+		fp.sendSamplesToNewRelic(samples, api.EventType, onDone)
+	}
+
+	// Only advance the tail offset once the new lines have been queued
+	if tailing {
+		fp.setTailOffset(api, nextOffset)
+	}
 
 	fp.logger.WithFields(logrus.Fields{
-		"api":          api.Name,
-		"record_count": result.RecordCount,
-		"duration":     result.Duration,
-		"is_stale":     result.IsStale,
+		"api":                 api.Name,
+		"record_count":        result.RecordCount,
+		"duration":            result.Duration,
+		"is_stale":            result.IsStale,
+		"invalid":             result.InvalidRecords,
+		"duplicates":          result.Duplicates,
+		"rejected_timestamps": result.RejectedTimestamps,
 	}).Info("API processing completed successfully")
 
 	fp.recordMetrics(result, result.Duration)
 	return result
 }
 
-// fetchData retrieves data from the specified URL
-func (fp *FileProcessor) fetchData(url string) ([]byte, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// handleStaleness records the staleness outcome on the result and reports
+// whether processing should stop, either because the check failed or the
+// data is stale with skip behavior
+func (fp *FileProcessor) handleStaleness(api config.APIConfig, stalenessResult *staleness.Result, result *ProcessResult) bool {
+	result.IsStale = stalenessResult.IsStale
+
+	if stalenessResult.Error != nil {
+		result.Error = fmt.Errorf("staleness check failed: %w", stalenessResult.Error)
+		result.HasError = true
+		return true
+	}
+
+	// Record staleness metrics
+	fp.metricsCollector.RecordStalenessMetrics(
+		api.Name,
+		stalenessResult.FileAge,
+		stalenessResult.Threshold,
+		stalenessResult.IsStale,
+	)
+
+	// Handle staleness behavior
+	if result.IsStale && stalenessResult.ShouldSkip {
+		fp.logger.WithField("api", api.Name).Info("Skipping processing due to stale file")
+		return true
 	}
 
-	req.Header.Set("User-Agent", "Enhanced-Flex-Monitor/1.0")
-	req.Header.Set("Accept", "application/json, text/csv, */*")
+	return false
+}
+
+// skipStaleMember evaluates an archive member's entry time against the
+// staleness threshold and reports whether the member should be skipped
+func (fp *FileProcessor) skipStaleMember(api config.APIConfig, member payloadMember, result *ProcessResult) bool {
+	memberName := fmt.Sprintf("%s/%s", api.Name, member.Name)
+	stalenessResult := fp.stalenessDetector.Evaluate(
+		memberName,
+		member.ModTime,
+		api.Staleness.Threshold,
+		api.Staleness.Behavior,
+	)
+
+	fp.metricsCollector.RecordStalenessMetrics(
+		memberName,
+		stalenessResult.FileAge,
+		stalenessResult.Threshold,
+		stalenessResult.IsStale,
+	)
+
+	if !stalenessResult.IsStale {
+		return false
+	}
 
-	fp.logger.WithField("url", url).Debug("Fetching data")
+	result.IsStale = true
+	if stalenessResult.ShouldSkip {
+		fp.logger.WithFields(logrus.Fields{
+			"api":    api.Name,
+			"member": member.Name,
+		}).Info("Skipping stale archive member")
+		return true
+	}
+	return false
+}
 
-	resp, err := fp.client.Do(req)
+// markContextDone flags a result that stopped because ctx ended, so that
+// shutdowns and per-API deadlines are reported apart from other failures
+func markContextDone(ctx context.Context, result *ProcessResult) {
+	switch ctx.Err() {
+	case context.Canceled:
+		result.Cancelled = true
+		result.HasError = false
+	case context.DeadlineExceeded:
+		result.TimedOut = true
+	}
+}
+
+// fetchData retrieves data from the API URL using its request settings. It
+// also returns the number of HTTP attempts made.
+func (fp *FileProcessor) fetchData(ctx context.Context, api config.APIConfig) ([]byte, int, error) {
+	data, _, attempts, err := fp.fetchResponse(ctx, api)
+	return data, attempts, err
+}
+
+// fetchResponse retrieves the body and headers of a successful response,
+// retrying transient failures according to the API's retry policy. A body
+// over max_body_bytes returns a *limitError.
+func (fp *FileProcessor) fetchResponse(ctx context.Context, api config.APIConfig) ([]byte, http.Header, int, error) {
+	client, err := fp.clientFor(api)
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+		return nil, nil, 0, err
+	}
+
+	fp.logger.WithFields(logrus.Fields{
+		"url":    api.URL,
+		"method": api.Request.Method,
+	}).Debug("Fetching data")
+
+	resp, attempts, err := transport.Do(ctx, client, api.Retry, fp.logger, func() (*http.Request, error) {
+		return newRequest(ctx, api, "application/json, text/csv, */*")
+	})
+	if err != nil {
+		return nil, nil, attempts, fmt.Errorf("HTTP request failed after %d attempt(s): %w", attempts, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP request returned status %d", resp.StatusCode)
+		return nil, nil, attempts, fmt.Errorf("HTTP request returned status %d after %d attempt(s)", resp.StatusCode, attempts)
 	}
 
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+	// A truncated body comes back together with its limit error
+	data, err := readBody(resp, api.Limits.MaxBodyBytes, api.Limits.BodyBehavior)
+	var limitErr *limitError
+	if err != nil && !(errors.As(err, &limitErr) && limitErr.hit.Behavior == "truncate") {
+		return nil, nil, attempts, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	fp.logger.WithFields(logrus.Fields{
-		"url":       url,
+		"url":       api.URL,
 		"data_size": len(data),
 		"status":    resp.StatusCode,
+		"attempts":  attempts,
 	}).Debug("Data fetched successfully")
 
-	return data, nil
+	return data, resp.Header, attempts, err
+}
+
+// processFormat converts a document to samples based on the API format. The
+// returned time is the newest timestamp found in the payload, if any.
+func (fp *FileProcessor) processFormat(data []byte, api config.APIConfig, fetchedAt time.Time) ([]map[string]interface{}, time.Time, error) {
+	switch strings.ToLower(api.Format) {
+	case "json":
+		samples, err := fp.processJSON(data, api, fetchedAt)
+		return samples, time.Time{}, err
+	case "csv":
+		samples, err := fp.processCSV(data, api)
+		return samples, time.Time{}, err
+	case "prometheus":
+		return fp.processPrometheus(data, api, fetchedAt)
+	case "xml":
+		samples, err := fp.processXML(data, api, fetchedAt)
+		return samples, time.Time{}, err
+	case "yaml":
+		samples, err := fp.processYAML(data, api, fetchedAt)
+		return samples, time.Time{}, err
+	case "regex":
+		samples, err := fp.processRegex(data, api, fetchedAt)
+		return samples, time.Time{}, err
+	default:
+		return nil, time.Time{}, fmt.Errorf("unsupported format: %s", api.Format)
+	}
 }
 
 // processJSON processes JSON data with optional JQ transformation
-func (fp *FileProcessor) processJSON(data []byte, api config.APIConfig) ([]map[string]interface{}, error) {
+func (fp *FileProcessor) processJSON(data []byte, api config.APIConfig, fetchedAt time.Time) ([]map[string]interface{}, error) {
 	var rawData interface{}
 	if err := json.Unmarshal(data, &rawData); err != nil {
 		return nil, fmt.Errorf("failed to parse JSON: %w", err)
 	}
 
+	return fp.processDocument(rawData, api, fetchedAt)
+}
+
+// processDocument applies the JQ transformation and explode settings to a
+// decoded document and converts the result to samples
+func (fp *FileProcessor) processDocument(rawData interface{}, api config.APIConfig, fetchedAt time.Time) ([]map[string]interface{}, error) {
 	// Apply JQ transformation if specified
 	if api.JQ != "" {
-		transformed, err := fp.applyJQTransformation(rawData, api.JQ)
+		transformed, err := fp.applyJQTransformation(rawData, api, fetchedAt)
 		if err != nil {
 			return nil, fmt.Errorf("JQ transformation failed: %w", err)
 		}
 		rawData = transformed
 	}
 
+	// Split nested arrays into one record per element
+	if api.Explode != nil {
+		var missing int
+		rawData, missing = explodeRecords(rawData, api.Explode)
+		if missing > 0 {
+			fp.logger.WithFields(logrus.Fields{
+				"api":     api.Name,
+				"records": missing,
+			}).Warn("Explode path missing or not an array")
+		}
+	}
+
 	// Convert to samples
 	samples, err := fp.convertToSamples(rawData, api)
 	if err != nil {
@@ -196,13 +588,11 @@ func (fp *FileProcessor) processJSON(data []byte, api config.APIConfig) ([]map[s
 	return samples, nil
 }
 
-// processCSV processes CSV data
+// processCSV processes CSV data using the API's dialect and column type settings
 func (fp *FileProcessor) processCSV(data []byte, api config.APIConfig) ([]map[string]interface{}, error) {
-	reader := csv.NewReader(strings.NewReader(string(data)))
-	reader.Comma = ','
-	reader.Comment = '#'
+	opts := api.CSV
 
-	records, err := reader.ReadAll()
+	records, err := readCSVRecords(skipLines(string(data), opts.SkipRows), opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse CSV: %w", err)
 	}
@@ -211,57 +601,79 @@ func (fp *FileProcessor) processCSV(data []byte, api config.APIConfig) ([]map[st
 		return []map[string]interface{}{}, nil
 	}
 
-	// Use first row as headers
-	headers := records[0]
+	// Use first row as headers unless explicit columns are configured
+	headers := opts.Columns
+	rows := records
+	firstRow := opts.SkipRows + 1
+	if !opts.NoHeader {
+		headers = records[0]
+		rows = records[1:]
+		firstRow++
+	}
+
 	var samples []map[string]interface{}
 
-	for i, record := range records[1:] {
+	for i, record := range rows {
 		if len(record) != len(headers) {
-			fp.logger.WithFields(logrus.Fields{
-				"row":              i + 2,
+			rowLogger := fp.logger.WithFields(logrus.Fields{
+				"row":              firstRow + i,
 				"expected_columns": len(headers),
 				"actual_columns":   len(record),
-			}).Warn("CSV row column count mismatch, skipping")
-			continue
+			})
+			if !opts.Lenient {
+				rowLogger.Warn("CSV row column count mismatch, skipping")
+				continue
+			}
+			rowLogger.Debug("CSV row column count mismatch, parsing leniently")
 		}
 
-		sample := make(map[string]interface{})
+		fields := make(map[string]interface{})
+		valid := true
 		for j, header := range headers {
-			value := record[j]
-			
-			// Try to convert to number if possible
-			if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
-				sample[header] = floatVal
-			} else if intVal, err := strconv.ParseInt(value, 10, 64); err == nil {
-				sample[header] = intVal
-			} else if boolVal, err := strconv.ParseBool(value); err == nil {
-				sample[header] = boolVal
-			} else {
-				sample[header] = value
+			if j >= len(record) {
+				break
 			}
+
+			value, err := convertValue(record[j], csvColumnType(opts, header), opts.TimestampLayout)
+			if err != nil {
+				if !opts.Lenient {
+					fp.logger.WithError(err).WithFields(logrus.Fields{
+						"row":    firstRow + i,
+						"column": header,
+					}).Warn("CSV value does not match column type, skipping row")
+					valid = false
+					break
+				}
+				value = record[j]
+			}
+			fields[header] = value
 		}
 
-		// Add custom attributes
-		fp.addCustomAttributes(sample, api)
-		samples = append(samples, sample)
+		if valid {
+			if sample, ok := fp.newSample(fields, api); ok {
+				samples = append(samples, sample)
+			}
+		}
 	}
 
 	return samples, nil
 }
 
-// applyJQTransformation applies JQ transformation to data
-func (fp *FileProcessor) applyJQTransformation(data interface{}, jqQuery string) (interface{}, error) {
-	query, err := gojq.Parse(jqQuery)
+// applyJQTransformation applies the API's JQ transformation to data.
+// Programs can reference $api, $attrs, $env and $now, plus the helper
+// functions registered in jqCompilerOptions.
+func (fp *FileProcessor) applyJQTransformation(data interface{}, api config.APIConfig, fetchedAt time.Time) (interface{}, error) {
+	query, err := gojq.Parse(api.JQ)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse JQ query: %w", err)
 	}
 
-	code, err := gojq.Compile(query)
+	code, err := gojq.Compile(query, jqCompilerOptions()...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compile JQ query: %w", err)
 	}
 
-	iter := code.Run(data)
+	iter := code.Run(data, jqVariableValues(api, fetchedAt)...)
 	for {
 		v, ok := iter.Next()
 		if !ok {
@@ -286,22 +698,16 @@ func (fp *FileProcessor) convertToSamples(data interface{}, api config.APIConfig
 		// Array of objects
 		for _, item := range v {
 			if itemMap, ok := item.(map[string]interface{}); ok {
-				sample := make(map[string]interface{})
-				for k, val := range itemMap {
-					sample[k] = val
+				if sample, ok := fp.newSample(itemMap, api); ok {
+					samples = append(samples, sample)
 				}
-				fp.addCustomAttributes(sample, api)
-				samples = append(samples, sample)
 			}
 		}
 	case map[string]interface{}:
 		// Single object
-		sample := make(map[string]interface{})
-		for k, val := range v {
-			sample[k] = val
+		if sample, ok := fp.newSample(v, api); ok {
+			samples = append(samples, sample)
 		}
-		fp.addCustomAttributes(sample, api)
-		samples = append(samples, sample)
 	default:
 		return nil, fmt.Errorf("unsupported data type for conversion: %T", data)
 	}
@@ -309,6 +715,33 @@ func (fp *FileProcessor) convertToSamples(data interface{}, api config.APIConfig
 	return samples, nil
 }
 
+// newSample builds a sample from record fields, flattening nested values
+// when configured, enriches it from lookup tables and adds the API's custom
+// attributes. Records that fail the API's schema are marked with their
+// violations. It returns false for samples dropped by a lookup miss.
+func (fp *FileProcessor) newSample(fields map[string]interface{}, api config.APIConfig) (map[string]interface{}, bool) {
+	violations := fp.validateRecord(fields, api)
+
+	var sample map[string]interface{}
+	if api.Flatten.Enabled {
+		sample = flattenFields(fields, api.Flatten)
+	} else {
+		sample = make(map[string]interface{}, len(fields))
+		for k, val := range fields {
+			sample[k] = val
+		}
+	}
+
+	if violations != "" {
+		sample[validationErrorsKey] = violations
+	}
+	if !fp.enrichSample(sample, api) {
+		return nil, false
+	}
+	fp.addCustomAttributes(sample, api)
+	return sample, true
+}
+
 // addCustomAttributes adds custom attributes to a sample
 func (fp *FileProcessor) addCustomAttributes(sample map[string]interface{}, api config.APIConfig) {
 	// Add API attributes
@@ -322,11 +755,26 @@ func (fp *FileProcessor) addCustomAttributes(sample map[string]interface{}, api
 	sample["processor.version"] = "1.0.0"
 }
 
-// sendSamplesToNewRelic sends processed samples to New Relic
-func (fp *FileProcessor) sendSamplesToNewRelic(samples []map[string]interface{}, eventType string) {
+// applyTransforms runs the API's transform steps on each sample. Values that
+// cannot be cast are kept as they are.
+func (fp *FileProcessor) applyTransforms(api config.APIConfig, samples []map[string]interface{}) error {
+	pipeline, err := transform.New(api.Transforms)
+	if err != nil {
+		return err
+	}
+
 	for _, sample := range samples {
-		fp.metricsCollector.AddEvent(eventType, sample)
+		if err := pipeline.Apply(sample); err != nil {
+			fp.logger.WithError(err).WithField("api", api.Name).Debug("Transform left values unchanged")
+		}
 	}
+	return nil
+}
+
+// sendSamplesToNewRelic sends processed samples to New Relic. onDone, when
+// not nil, runs once the collector's send has finished.
+func (fp *FileProcessor) sendSamplesToNewRelic(samples []map[string]interface{}, eventType string, onDone func(delivered bool)) {
+	fp.metricsCollector.AddEvents(eventType, samples, onDone)
 }
 
 // recordMetrics records processing metrics
@@ -338,10 +786,19 @@ func (fp *FileProcessor) recordMetrics(result *ProcessResult, duration time.Dura
 		result.IsStale,
 		result.HasError,
 	)
+
+	// Results that stopped before a request (e.g. skipped as stale) made no attempts
+	if result.ProbeAttempts > 0 {
+		fp.metricsCollector.RecordFetchAttempts(result.APIName, "staleness", result.ProbeAttempts, result.HasError)
+	}
+	if result.Attempts > 0 {
+		fp.metricsCollector.RecordFetchAttempts(result.APIName, "fetch", result.Attempts, result.HasError)
+	}
 }
 
-// ProcessAPIs processes multiple APIs concurrently
-func (fp *FileProcessor) ProcessAPIs(apis []config.APIConfig, maxWorkers int) []*ProcessResult {
+// ProcessAPIs processes multiple APIs concurrently. APIs still queued when ctx
+// is cancelled are reported as cancelled without being fetched.
+func (fp *FileProcessor) ProcessAPIs(ctx context.Context, apis []config.APIConfig, maxWorkers int) []*ProcessResult {
 	if maxWorkers <= 0 {
 		maxWorkers = 4
 	}
@@ -353,8 +810,13 @@ func (fp *FileProcessor) ProcessAPIs(apis []config.APIConfig, maxWorkers int) []
 	for i := 0; i < maxWorkers; i++ {
 		go func() {
 			for api := range jobs {
-				if api.Enabled {
-					result := fp.ProcessAPI(api)
+				if ctx.Err() != nil {
+					results <- &ProcessResult{
+						APIName:   api.Name,
+						Cancelled: true,
+					}
+				} else if api.Enabled {
+					result := fp.ProcessAPI(ctx, api)
 					results <- result
 				} else {
 					// Send empty result for disabled APIs
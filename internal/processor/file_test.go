@@ -0,0 +1,1858 @@
+package processor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/metrics"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/staleness"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/transport"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestProcessor() *FileProcessor {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel) // Suppress logs during tests
+
+	collector := metrics.NewCollector(config.NewRelicConfig{}, logger)
+	return NewFileProcessor(logger, collector, staleness.NewDetector(logger), transport.NewRegistry(logger, collector))
+}
+
+func TestJQVariablesAndFunctions(t *testing.T) {
+	fp := newTestProcessor()
+	os.Setenv("JQ_TEST_REGION", "eu-west-1")
+	defer os.Unsetenv("JQ_TEST_REGION")
+
+	fetchedAt := time.Unix(1700000000, 0)
+	api := config.APIConfig{
+		Name:       "orders",
+		Attributes: map[string]string{"team": "checkout"},
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		input    interface{}
+		expected interface{}
+	}{
+		{name: "api name", query: "$api", input: nil, expected: "orders"},
+		{name: "attributes", query: "$attrs.team", input: nil, expected: "checkout"},
+		{name: "environment", query: "$env.JQ_TEST_REGION", input: nil, expected: "eu-west-1"},
+		{name: "fetch timestamp", query: "$now", input: nil, expected: float64(1700000000)},
+		{name: "parse_duration", query: ".timeout | parse_duration", input: map[string]interface{}{"timeout": "1m30s"}, expected: float64(90)},
+		{name: "to_epoch", query: `.at | to_epoch("2006-01-02T15:04:05Z07:00")`, input: map[string]interface{}{"at": "2023-11-14T22:13:20Z"}, expected: float64(1700000000)},
+		{name: "sha256", query: ".email | sha256", input: map[string]interface{}{"email": "abc"}, expected: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api.JQ = tt.query
+			result, err := fp.applyJQTransformation(tt.input, api, fetchedAt)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v (%T), got %v (%T)", tt.expected, tt.expected, result, result)
+			}
+		})
+	}
+}
+
+func TestJQFunctionErrors(t *testing.T) {
+	fp := newTestProcessor()
+
+	api := config.APIConfig{Name: "orders", JQ: ".timeout | parse_duration"}
+	if _, err := fp.applyJQTransformation(map[string]interface{}{"timeout": "soon"}, api, time.Now()); err == nil {
+		t.Error("Expected error for invalid duration, got none")
+	}
+}
+
+func TestFlattenFields(t *testing.T) {
+	fields := map[string]interface{}{
+		"id": float64(1),
+		"host": map[string]interface{}{
+			"name": "web-1",
+			"disk": map[string]interface{}{"used": float64(42)},
+		},
+		"tags": []interface{}{"a", "b"},
+	}
+
+	tests := []struct {
+		name     string
+		cfg      config.FlattenConfig
+		expected map[string]interface{}
+	}{
+		{
+			name: "index arrays",
+			cfg:  config.FlattenConfig{Enabled: true, Separator: ".", MaxDepth: 10, Arrays: "index", MaxKeyLength: 255},
+			expected: map[string]interface{}{
+				"id": float64(1), "host.name": "web-1", "host.disk.used": float64(42), "tags.0": "a", "tags.1": "b",
+			},
+		},
+		{
+			name: "join arrays with depth limit",
+			cfg:  config.FlattenConfig{Enabled: true, Separator: ".", MaxDepth: 2, Arrays: "join", JoinSeparator: "|", MaxKeyLength: 255},
+			expected: map[string]interface{}{
+				"id": float64(1), "host.name": "web-1", "host.disk": `{"used":42}`, "tags": "a|b",
+			},
+		},
+		{
+			name: "drop arrays with key limit",
+			cfg:  config.FlattenConfig{Enabled: true, Separator: "_", MaxDepth: 10, Arrays: "drop", MaxKeyLength: 9},
+			expected: map[string]interface{}{
+				"id": float64(1), "host_name": "web-1", "host_disk": float64(42),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flat := flattenFields(fields, tt.cfg)
+			if len(flat) != len(tt.expected) {
+				t.Fatalf("Expected %d keys, got %d: %v", len(tt.expected), len(flat), flat)
+			}
+			for k, v := range tt.expected {
+				if flat[k] != v {
+					t.Errorf("Expected %s=%v, got %v", k, v, flat[k])
+				}
+			}
+		})
+	}
+}
+
+func TestFlattenKeyLimit(t *testing.T) {
+	fields := map[string]interface{}{
+		"status": map[string]interface{}{"abdéfg": "ok"},
+		"request": map[string]interface{}{
+			"count_total":  float64(10),
+			"count_failed": float64(2),
+		},
+		"request.cou": "kept",
+	}
+	cfg := config.FlattenConfig{Enabled: true, Separator: ".", MaxDepth: 10, Arrays: "index", MaxKeyLength: 11}
+
+	flat := flattenFields(fields, cfg)
+	if len(flat) != 4 {
+		t.Fatalf("Expected every value under its own key, got %v", flat)
+	}
+	if flat["status.abd"] != "ok" {
+		t.Errorf("Expected the key cut before the split rune, got %v", flat)
+	}
+	if flat["request.cou"] != "kept" {
+		t.Errorf("Expected a key within the limit to keep its name, got %v", flat)
+	}
+	values := map[interface{}]bool{}
+	for k, v := range flat {
+		if len(k) > cfg.MaxKeyLength || !utf8.ValidString(k) {
+			t.Errorf("Expected a valid key of at most %d bytes, got %q", cfg.MaxKeyLength, k)
+		}
+		if strings.HasPrefix(k, "re~") {
+			values[v] = true
+		}
+	}
+	if !values[float64(10)] || !values[float64(2)] {
+		t.Errorf("Expected colliding keys to get hash suffixes, got %v", flat)
+	}
+}
+
+func TestExplodeRecords(t *testing.T) {
+	document := map[string]interface{}{
+		"report_id": "r-1",
+		"regions": []interface{}{
+			map[string]interface{}{
+				"region": "eu",
+				"hosts": []interface{}{
+					map[string]interface{}{"host": "a", "cpu": float64(10)},
+					map[string]interface{}{"host": "b", "cpu": float64(20)},
+				},
+			},
+			map[string]interface{}{
+				"region": "us",
+				"hosts": []interface{}{
+					map[string]interface{}{"host": "c", "cpu": float64(30), "report_id": "override"},
+				},
+			},
+		},
+	}
+
+	cfg := &config.ExplodeConfig{
+		Path:    "regions",
+		Inherit: []string{"report_id"},
+		Explode: &config.ExplodeConfig{
+			Path:    "hosts",
+			Inherit: []string{"region"},
+		},
+	}
+
+	exploded, _ := explodeRecords(document, cfg)
+	rows, ok := exploded.([]interface{})
+	if !ok || len(rows) != 3 {
+		t.Fatalf("Expected 3 exploded rows, got %v", rows)
+	}
+
+	expected := []map[string]interface{}{
+		{"report_id": "r-1", "region": "eu", "host": "a"},
+		{"report_id": "r-1", "region": "eu", "host": "b"},
+		{"report_id": "override", "region": "us", "host": "c"},
+	}
+	for i, want := range expected {
+		row := rows[i].(map[string]interface{})
+		for k, v := range want {
+			if row[k] != v {
+				t.Errorf("Row %d: expected %s=%v, got %v", i, k, v, row[k])
+			}
+		}
+		if _, ok := row["hosts"]; ok {
+			t.Errorf("Row %d: exploded array should not be inherited", i)
+		}
+	}
+}
+
+func TestExplodeRecordsMissingPath(t *testing.T) {
+	document := []interface{}{
+		map[string]interface{}{"report_id": "r-1", "hosts": []interface{}{map[string]interface{}{"host": "a"}}},
+		map[string]interface{}{"report_id": "r-2"},
+		map[string]interface{}{"report_id": "r-3", "hosts": "none"},
+	}
+
+	tests := []struct {
+		name      string
+		onMissing string
+		expected  []string
+	}{
+		{name: "kept by default", expected: []string{"r-1", "r-2", "r-3"}},
+		{name: "dropped", onMissing: "drop", expected: []string{"r-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.ExplodeConfig{Path: "hosts", Inherit: []string{"report_id"}, OnMissing: tt.onMissing}
+			exploded, missing := explodeRecords(document, cfg)
+			rows := exploded.([]interface{})
+			if missing != 2 {
+				t.Errorf("Expected 2 records without the array, got %d", missing)
+			}
+			if len(rows) != len(tt.expected) {
+				t.Fatalf("Expected %d rows, got %v", len(tt.expected), rows)
+			}
+			for i, id := range tt.expected {
+				if row := rows[i].(map[string]interface{}); row["report_id"] != id {
+					t.Errorf("Row %d: expected report_id %s, got %v", i, id, row["report_id"])
+				}
+			}
+		})
+	}
+}
+
+func TestProcessCSVDialectAndSchema(t *testing.T) {
+	fp := newTestProcessor()
+
+	data := []byte("exported by billing\nzip;amount;active;seen\n02134;12;true;2024-01-02T03:04:05Z\n10001;oops;false;2024-01-02T03:04:05Z\n")
+	api := config.APIConfig{
+		Name: "billing",
+		CSV: config.CSVConfig{
+			Delimiter:       ";",
+			Comment:         "none",
+			Quotes:          "strict",
+			SkipRows:        1,
+			Types:           map[string]string{"zip": "string", "amount": "int", "seen": "timestamp"},
+			DefaultType:     "auto",
+			TimestampLayout: time.RFC3339,
+		},
+	}
+
+	samples, err := fp.processCSV(data, api)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(samples) != 1 {
+		t.Fatalf("Expected invalid row to be skipped, got %d samples", len(samples))
+	}
+	if samples[0]["zip"] != "02134" {
+		t.Errorf("Expected zip to stay a string, got %v (%T)", samples[0]["zip"], samples[0]["zip"])
+	}
+	if samples[0]["amount"] != int64(12) {
+		t.Errorf("Expected amount=12, got %v (%T)", samples[0]["amount"], samples[0]["amount"])
+	}
+	if samples[0]["active"] != true {
+		t.Errorf("Expected active=true, got %v", samples[0]["active"])
+	}
+	if samples[0]["seen"] != int64(1704164645) {
+		t.Errorf("Expected seen=1704164645, got %v", samples[0]["seen"])
+	}
+
+	// Lenient mode keeps unparsable values and short rows
+	api.CSV.Lenient = true
+	samples, err = fp.processCSV(append(data, []byte("02139;5\n")...), api)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("Expected 3 samples in lenient mode, got %d", len(samples))
+	}
+	if samples[1]["amount"] != "oops" {
+		t.Errorf("Expected raw value to be kept, got %v", samples[1]["amount"])
+	}
+}
+
+func TestProcessCSVWithoutHeader(t *testing.T) {
+	fp := newTestProcessor()
+
+	api := config.APIConfig{
+		Name: "sensors",
+		CSV: config.CSVConfig{
+			Delimiter:   "|",
+			Comment:     "#",
+			Quotes:      "none",
+			NoHeader:    true,
+			Columns:     []string{"sensor", "reading"},
+			DefaultType: "auto",
+		},
+	}
+
+	samples, err := fp.processCSV([]byte("# comment\n\"s1\"|1.5\ns2|2.5\n"), api)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("Expected 2 samples, got %d", len(samples))
+	}
+	if samples[0]["sensor"] != `"s1"` || samples[1]["reading"] != 2.5 {
+		t.Errorf("Unexpected samples: %v", samples)
+	}
+}
+
+func TestProcessPrometheus(t *testing.T) {
+	fp := newTestProcessor()
+
+	data := []byte(`# HELP http_requests_total Total HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",path="/a \"b\""} 1027 1700000000000
+http_requests_total{method="POST",path="/"} 3 1700000060000
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="+Inf"} 7
+latency_seconds_sum 1.5
+up NaN
+`)
+	api := config.APIConfig{Name: "prom", Prometheus: config.PrometheusConfig{Mode: "samples"}}
+
+	samples, newest, err := fp.processPrometheus(data, api, time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(samples) != 4 {
+		t.Fatalf("Expected 4 samples (NaN skipped), got %d", len(samples))
+	}
+
+	first := samples[0]
+	if first["metric.name"] != "http_requests_total" || first["metric.type"] != "counter" || first["metric.value"] != float64(1027) {
+		t.Errorf("Unexpected first sample: %v", first)
+	}
+	if first["method"] != "GET" || first["path"] != `/a "b"` {
+		t.Errorf("Expected labels to become attributes, got %v", first)
+	}
+	if first["metric.help"] != "Total HTTP requests." {
+		t.Errorf("Expected HELP text, got %v", first["metric.help"])
+	}
+	if samples[2]["metric.type"] != "histogram" {
+		t.Errorf("Expected bucket series to inherit histogram type, got %v", samples[2]["metric.type"])
+	}
+	if !newest.Equal(time.UnixMilli(1700000060000)) {
+		t.Errorf("Expected newest timestamp 1700000060000, got %v", newest.UnixMilli())
+	}
+}
+
+func TestProcessXML(t *testing.T) {
+	fp := newTestProcessor()
+
+	data := []byte(`<?xml version="1.0"?>
+<status generated="2024-01-01">
+  <service name="db" state="up"><latency unit="ms">12</latency></service>
+  <service name="cache" state="down"/>
+  <owner>platform</owner>
+</status>`)
+	api := config.APIConfig{
+		Name: "legacy",
+		JQ:   `.status as $s | $s.service | map({name: ."@name", state: ."@state", owner: $s.owner, generated: $s."@generated"})`,
+		XML:  config.XMLConfig{AttributePrefix: "@", TextKey: "#text"},
+	}
+
+	samples, err := fp.processXML(data, api, time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("Expected repeated elements to become 2 samples, got %d", len(samples))
+	}
+	if samples[0]["name"] != "db" || samples[1]["state"] != "down" || samples[0]["owner"] != "platform" || samples[0]["generated"] != "2024-01-01" {
+		t.Errorf("Unexpected samples: %v", samples)
+	}
+
+	doc, err := decodeXML(data, api.XML)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	latency := doc.(map[string]interface{})["status"].(map[string]interface{})["service"].([]interface{})[0].(map[string]interface{})["latency"].(map[string]interface{})
+	if latency["#text"] != "12" || latency["@unit"] != "ms" {
+		t.Errorf("Expected text and attributes on mixed element, got %v", latency)
+	}
+}
+
+func TestProcessYAML(t *testing.T) {
+	fp := newTestProcessor()
+
+	data := []byte("service: api\nchecked: 2024-01-02T03:04:05Z\nreplicas: 3\n---\nservice: worker\nchecked: 2024-01-02T03:04:05Z\nreplicas: 1\n")
+	samples, err := fp.processYAML(data, config.APIConfig{Name: "vendor"}, time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("Expected one sample per YAML document, got %d", len(samples))
+	}
+	if samples[1]["service"] != "worker" || samples[0]["replicas"] != 3 || samples[0]["checked"] != "2024-01-02T03:04:05Z" {
+		t.Errorf("Unexpected samples: %v", samples)
+	}
+}
+
+func TestProcessRegexMultiline(t *testing.T) {
+	fp := newTestProcessor()
+
+	data := []byte("stray continuation\n" +
+		"2024-01-02T03:04:05Z ERROR [api] request failed took=12ms\n" +
+		"  at handler.go:10\n" +
+		"  at server.go:20\n" +
+		"2024-01-02T03:04:06Z INFO [api] request ok took=3ms\n" +
+		"garbage line\n")
+
+	api := config.APIConfig{
+		Name: "server-log",
+		Regex: config.RegexConfig{
+			Pattern:         `(?s)^(?P<time>\S+) (?P<level>\w+) \[(?P<source>\w+)\] (?P<message>.*?) took=(?P<took>\d+)ms(?:\n(?P<stack>.*))?$`,
+			RecordStart:     `^\d{4}-\d{2}-\d{2}T`,
+			Types:           map[string]string{"time": "timestamp", "took": "int"},
+			TimestampLayout: time.RFC3339,
+		},
+	}
+
+	samples, err := fp.processRegex(data, api, time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("Expected 2 records, got %d: %v", len(samples), samples)
+	}
+	if samples[0]["level"] != "ERROR" || samples[0]["took"] != int64(12) || samples[0]["time"] != int64(1704164645) {
+		t.Errorf("Unexpected first record: %v", samples[0])
+	}
+	if samples[0]["stack"] != "  at handler.go:10\n  at server.go:20" {
+		t.Errorf("Expected continuation lines in stack, got %q", samples[0]["stack"])
+	}
+	if samples[1]["stack"] != "garbage line" {
+		t.Errorf("Expected trailing line to continue the last record, got %q", samples[1]["stack"])
+	}
+}
+
+func TestFetchTail(t *testing.T) {
+	fp := newTestProcessor()
+
+	content := "line one\nline two\npartial"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "server.log", time.Now(), strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	api := config.APIConfig{Name: "tail", URL: server.URL}
+
+	data, next, _, err := fp.fetchTail(context.Background(), api)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != "line one\nline two\n" || next != 18 {
+		t.Fatalf("Expected complete lines up to offset 18, got %q at %d", data, next)
+	}
+	fp.setTailOffset(api, next)
+
+	// No complete new line yet
+	data, next, _, err = fp.fetchTail(context.Background(), api)
+	if err != nil || len(data) != 0 || next != 18 {
+		t.Fatalf("Expected no new data, got %q at %d (err %v)", data, next, err)
+	}
+
+	content += " done\nline four\n"
+	data, next, _, err = fp.fetchTail(context.Background(), api)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != "partial done\nline four\n" || next != int64(len(content)) {
+		t.Errorf("Expected only appended lines, got %q at %d", data, next)
+	}
+	fp.setTailOffset(api, next)
+
+	// Rotation resets the offset
+	content = "fresh\n"
+	data, _, _, err = fp.fetchTail(context.Background(), api)
+	if err != nil || string(data) != "fresh\n" {
+		t.Errorf("Expected rotated file to be read from the start, got %q (err %v)", data, err)
+	}
+}
+
+func TestFetchTailRotationWithConcurrencyLimit(t *testing.T) {
+	fp := newTestProcessor()
+
+	content := "fresh\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "server.log", time.Now(), strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	api := config.APIConfig{
+		Name:      "tail",
+		URL:       server.URL,
+		RateLimit: config.RateLimitConfig{MaxConcurrency: 1},
+	}
+	fp.setTailOffset(api, 100)
+
+	// The refetch after a 416 needs the only slot on the host
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	data, next, _, err := fp.fetchTail(ctx, api)
+	if err != nil || string(data) != "fresh\n" || next != 6 {
+		t.Errorf("Expected rotated file to be read from the start, got %q at %d (err %v)", data, next, err)
+	}
+}
+
+func TestFetchTailHoldsOpenRecord(t *testing.T) {
+	fp := newTestProcessor()
+
+	content := "2024-01-02 ERROR first\n  at handler.go:10\n2024-01-02 ERROR second\n  at server.go:20\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "server.log", time.Now(), strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	api := config.APIConfig{
+		Name:  "tail",
+		URL:   server.URL,
+		Regex: config.RegexConfig{RecordStart: `^\d{4}-`, Tail: true},
+	}
+
+	data, next, _, err := fp.fetchTail(context.Background(), api)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != "2024-01-02 ERROR first\n  at handler.go:10\n" || next != 42 {
+		t.Fatalf("Expected the last record to be held back at offset 42, got %q at %d", data, next)
+	}
+	fp.setTailOffset(api, next)
+
+	// More continuation lines, but the record is still open
+	content += "  at main.go:30\n"
+	data, next, _, err = fp.fetchTail(context.Background(), api)
+	if err != nil || len(data) != 0 || next != 42 {
+		t.Fatalf("Expected the open record to stay held back, got %q at %d (err %v)", data, next, err)
+	}
+
+	content += "2024-01-02 INFO third\n"
+	data, next, _, err = fp.fetchTail(context.Background(), api)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != "2024-01-02 ERROR second\n  at server.go:20\n  at main.go:30\n" || next != int64(len(content))-22 {
+		t.Errorf("Expected the complete second record, got %q at %d", data, next)
+	}
+	fp.setTailOffset(api, next)
+
+	// The log went quiet, so the last record is complete
+	data, next, _, err = fp.fetchTail(context.Background(), api)
+	if err != nil || string(data) != "2024-01-02 INFO third\n" || next != int64(len(content)) {
+		t.Errorf("Expected the held record once the log stopped growing, got %q at %d (err %v)", data, next, err)
+	}
+}
+
+func TestTailOffsetPersisted(t *testing.T) {
+	content := "one\ntwo\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "server.log", time.Now(), strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	api := config.APIConfig{
+		Name:        "tail",
+		URL:         server.URL,
+		Format:      "regex",
+		Compression: "none",
+		Regex:       config.RegexConfig{Pattern: `^(?P<word>\w+)$`, Tail: true, StateDir: t.TempDir()},
+	}
+
+	result := newTestProcessor().ProcessAPI(context.Background(), api)
+	if result.HasError || result.RecordCount != 2 {
+		t.Fatalf("Expected 2 records, got %d (err %v)", result.RecordCount, result.Error)
+	}
+
+	// A restarted processor resumes after the lines already read
+	content += "three\n"
+	result = newTestProcessor().ProcessAPI(context.Background(), api)
+	if result.HasError || result.RecordCount != 1 || result.Samples[0]["word"] != "three" {
+		t.Errorf("Expected only the new line after a restart, got %d records (err %v)", result.RecordCount, result.Error)
+	}
+}
+
+func TestProcessAPITailRecordLimit(t *testing.T) {
+	content := "one\ntwo\nthree\nfour\nfive\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "server.log", time.Now(), strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	api := config.APIConfig{
+		Name:   "tail",
+		URL:    server.URL,
+		Format: "regex",
+		Regex:  config.RegexConfig{Pattern: `^(?P<word>\w+)$`, Tail: true},
+		Limits: config.LimitsConfig{MaxRecords: 2, BodyBehavior: "error", RecordsBehavior: "truncate"},
+	}
+
+	// Records over the limit are read on the next cycle, not dropped
+	fp := newTestProcessor()
+	var words []interface{}
+	for _, expected := range []int{2, 2, 1, 0} {
+		result := fp.ProcessAPI(context.Background(), api)
+		if result.HasError || result.RecordCount != expected {
+			t.Fatalf("Expected %d records, got %d (err %v)", expected, result.RecordCount, result.Error)
+		}
+		for _, sample := range result.Samples {
+			words = append(words, sample["word"])
+		}
+	}
+	if fmt.Sprint(words) != "[one two three four five]" {
+		t.Errorf("Expected every line once, got %v", words)
+	}
+}
+
+func TestProcessAPIWithCompressedArchive(t *testing.T) {
+	fp := newTestProcessor()
+
+	var tarball bytes.Buffer
+	gz := gzip.NewWriter(&tarball)
+	tw := tar.NewWriter(gz)
+	entries := []struct {
+		name    string
+		body    string
+		modTime time.Time
+	}{
+		{name: "export/fresh.json", body: `[{"id": 1}]`, modTime: time.Now().Add(-time.Minute)},
+		{name: "export/old.json", body: `[{"id": 2}]`, modTime: time.Now().Add(-2 * time.Hour)},
+		{name: "export/README.txt", body: "not data", modTime: time.Now()},
+	}
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), ModTime: e.modTime, Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		tw.Write([]byte(e.body))
+	}
+	tw.Close()
+	gz.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball.Bytes())
+	}))
+	defer server.Close()
+
+	api := config.APIConfig{
+		Name:        "nightly",
+		URL:         server.URL + "/export.tar.gz",
+		Format:      "json",
+		Compression: "auto",
+		Archive:     config.ArchiveConfig{Members: []string{"*.json"}},
+		Enabled:     true,
+		Staleness: config.StalenessConfig{
+			Enabled:   true,
+			Threshold: time.Hour,
+			Behavior:  "skip",
+			Source:    "payload",
+		},
+	}
+
+	result := fp.ProcessAPI(context.Background(), api)
+	if result.HasError {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+	if !result.IsStale {
+		t.Error("Expected result to be marked stale because of the old member")
+	}
+	if result.RecordCount != 1 {
+		t.Fatalf("Expected only the fresh member to be processed, got %d records", result.RecordCount)
+	}
+	if result.Samples[0]["archive.member"] != "export/fresh.json" {
+		t.Errorf("Expected archive.member attribute, got %v", result.Samples[0]["archive.member"])
+	}
+}
+
+func TestProcessAPIPayloadStaleness(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		body        string
+		expectStale bool
+		expectError bool
+	}{
+		{name: "fresh samples", body: fmt.Sprintf("up 1 %d\n", time.Now().UnixMilli())},
+		{name: "old samples", body: fmt.Sprintf("up 1 %d\n", time.Now().Add(-2*time.Hour).UnixMilli()), expectStale: true},
+		{name: "no timestamps", body: "up 1\n", expectError: true},
+		{name: "source in mixed case", source: "Payload", body: fmt.Sprintf("up 1 %d\n", time.Now().Add(-2*time.Hour).UnixMilli()), expectStale: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			source := tt.source
+			if source == "" {
+				source = "payload"
+			}
+			api := config.APIConfig{
+				Name:        "prom",
+				URL:         server.URL,
+				Format:      "prometheus",
+				Compression: "none",
+				Staleness:   config.StalenessConfig{Enabled: true, Threshold: time.Hour, Behavior: "skip", Source: source},
+			}
+
+			result := newTestProcessor().ProcessAPI(context.Background(), api)
+			if result.HasError != tt.expectError {
+				t.Fatalf("Expected error %v, got %v", tt.expectError, result.Error)
+			}
+			if result.IsStale != tt.expectStale {
+				t.Errorf("Expected stale %v, got %v", tt.expectStale, result.IsStale)
+			}
+			if !tt.expectError && !tt.expectStale && result.RecordCount != 1 {
+				t.Errorf("Expected 1 record, got %d", result.RecordCount)
+			}
+		})
+	}
+}
+
+func TestFetchDataWithRequestSettings(t *testing.T) {
+	fp := newTestProcessor()
+	t.Setenv("FETCH_TOKEN", "abc123")
+
+	bodyFile := t.TempDir() + "/query.json"
+	if err := os.WriteFile(bodyFile, []byte(`{"query": "status"}`), 0644); err != nil {
+		t.Fatalf("Failed to write body file: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.Method != "POST":
+			t.Errorf("Expected POST, got %s", r.Method)
+		case r.Header.Get("X-Api-Key") != "abc123":
+			t.Errorf("Expected expanded header, got %q", r.Header.Get("X-Api-Key"))
+		case r.Header.Get("User-Agent") != "Enhanced-Flex-Monitor/1.0":
+			t.Errorf("Expected default User-Agent, got %q", r.Header.Get("User-Agent"))
+		case r.URL.Query().Get("page") != "1" || r.URL.Query().Get("limit") != "50":
+			t.Errorf("Expected merged query, got %q", r.URL.RawQuery)
+		case string(body) != `{"query": "status"}`:
+			t.Errorf("Expected body from file, got %q", body)
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	api := config.APIConfig{
+		Name: "request",
+		URL:  server.URL + "?page=1",
+		Request: config.RequestConfig{
+			Method:   "post",
+			Headers:  map[string]string{"X-Api-Key": "$FETCH_TOKEN"},
+			BodyFile: bodyFile,
+			Query:    map[string]string{"limit": "50"},
+		},
+	}
+
+	if _, _, err := fp.fetchData(context.Background(), api); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The request timeout overrides the client default
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	api = config.APIConfig{Name: "slow", URL: slow.URL, Request: config.RequestConfig{Timeout: 20 * time.Millisecond}}
+	if _, _, err := fp.fetchData(context.Background(), api); err == nil {
+		t.Error("Expected timeout error")
+	}
+}
+
+func TestFetchPages(t *testing.T) {
+	fp := newTestProcessor()
+
+	// Seven items served two per page by every strategy
+	items := []string{`{"id": 1}`, `{"id": 2}`, `{"id": 3}`, `{"id": 4}`, `{"id": 5}`, `{"id": 6}`, `{"id": 7}`}
+	pageOf := func(start int) []string {
+		if start >= len(items) {
+			return nil
+		}
+		end := start + 2
+		if end > len(items) {
+			end = len(items)
+		}
+		return items[start:end]
+	}
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/link":
+			start, _ := strconv.Atoi(q.Get("from"))
+			if start+2 < len(items) {
+				w.Header().Set("Link", fmt.Sprintf(`</link?from=%d>; rel="next", </link?from=6>; rel="last"`, start+2))
+			}
+			fmt.Fprintf(w, "[%s]", strings.Join(pageOf(start), ","))
+		case "/cursor":
+			start, _ := strconv.Atoi(q.Get("after"))
+			next := "null"
+			if start+2 < len(items) {
+				next = fmt.Sprintf(`"%d"`, start+2)
+			}
+			fmt.Fprintf(w, `{"data": [%s], "meta": {"next": %s}}`, strings.Join(pageOf(start), ","), next)
+		case "/offset":
+			start, _ := strconv.Atoi(q.Get("offset"))
+			fmt.Fprintf(w, `{"results": [%s]}`, strings.Join(pageOf(start), ","))
+		case "/page":
+			page, _ := strconv.Atoi(q.Get("page"))
+			fmt.Fprintf(w, "[%s]", strings.Join(pageOf((page-1)*2), ","))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		pagination   config.PaginationConfig
+		expectedIDs  int
+		expectedReqs int
+	}{
+		{
+			name:         "link header",
+			path:         "/link",
+			pagination:   config.PaginationConfig{Type: "link", MaxPages: 10},
+			expectedIDs:  7,
+			expectedReqs: 4,
+		},
+		{
+			name:         "cursor from jq",
+			path:         "/cursor",
+			pagination:   config.PaginationConfig{Type: "cursor", RecordsPath: "data", CursorQuery: ".meta.next", CursorParam: "after", MaxPages: 10},
+			expectedIDs:  7,
+			expectedReqs: 4,
+		},
+		{
+			name:         "offset and limit",
+			path:         "/offset",
+			pagination:   config.PaginationConfig{Type: "offset", RecordsPath: "results", OffsetParam: "offset", LimitParam: "limit", Limit: 2, MaxPages: 10},
+			expectedIDs:  7,
+			expectedReqs: 4,
+		},
+		{
+			name:         "page number",
+			path:         "/page",
+			pagination:   config.PaginationConfig{Type: "page", PageParam: "page", StartPage: 1, LimitParam: "per_page", Limit: 2, MaxPages: 10},
+			expectedIDs:  7,
+			expectedReqs: 4,
+		},
+		{
+			name:         "max pages",
+			path:         "/link",
+			pagination:   config.PaginationConfig{Type: "link", MaxPages: 2},
+			expectedIDs:  4,
+			expectedReqs: 2,
+		},
+		{
+			name:         "max records",
+			path:         "/page",
+			pagination:   config.PaginationConfig{Type: "page", PageParam: "page", StartPage: 1, LimitParam: "per_page", Limit: 2, MaxPages: 10, MaxRecords: 3},
+			expectedIDs:  3,
+			expectedReqs: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			api := config.APIConfig{Name: tt.name, URL: server.URL + tt.path, Format: "json", Pagination: tt.pagination}
+
+			data, _, err := fp.fetchPages(context.Background(), api)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var records []map[string]interface{}
+			if err := json.Unmarshal(data, &records); err != nil {
+				t.Fatalf("Expected JSON array, got %s", data)
+			}
+			if len(records) != tt.expectedIDs {
+				t.Errorf("Expected %d records, got %d", tt.expectedIDs, len(records))
+			}
+			for i, record := range records {
+				if record["id"] != float64(i+1) {
+					t.Errorf("Expected records in page order, got %v at %d", record["id"], i)
+				}
+			}
+			if requests != tt.expectedReqs {
+				t.Errorf("Expected %d requests, got %d", tt.expectedReqs, requests)
+			}
+		})
+	}
+}
+
+func TestFetchPagesCrossHostLink(t *testing.T) {
+	fp := newTestProcessor()
+
+	var foreign *http.Request
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		foreign = r
+		w.Write([]byte(`[{"id": 2}]`))
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" || r.URL.Query().Get("token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s/next>; rel="next"`, other.URL))
+		w.Write([]byte(`[{"id": 1}]`))
+	}))
+	defer server.Close()
+
+	api := config.APIConfig{
+		Name:       "cross-host",
+		URL:        server.URL,
+		Format:     "json",
+		Pagination: config.PaginationConfig{Type: "link", MaxPages: 10},
+		Request: config.RequestConfig{
+			Headers: map[string]string{"X-Api-Key": "secret"},
+			Query:   map[string]string{"token": "secret"},
+		},
+	}
+
+	data, _, err := fp.fetchPages(context.Background(), api)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != `[{"id":1},{"id":2}]` {
+		t.Errorf("Expected records from both hosts, got %s", data)
+	}
+	if foreign == nil {
+		t.Fatal("Expected the linked page to be fetched")
+	}
+	if foreign.Header.Get("X-Api-Key") != "" || foreign.URL.Query().Get("token") != "" {
+		t.Errorf("Expected configured credentials to stay on the API host, got headers %v and query %q", foreign.Header, foreign.URL.RawQuery)
+	}
+}
+
+func TestProcessAPIRetriesTransientErrors(t *testing.T) {
+	fp := newTestProcessor()
+
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`[{"id": 1}]`))
+	}))
+	defer server.Close()
+
+	api := config.APIConfig{
+		Name:        "flaky",
+		URL:         server.URL,
+		Format:      "json",
+		EventType:   "FlakyEvent",
+		Compression: "none",
+		Retry: config.RetryConfig{
+			MaxAttempts:   3,
+			BaseBackoff:   time.Millisecond,
+			MaxBackoff:    time.Millisecond,
+			RetryOnStatus: []int{502},
+		},
+	}
+
+	result := fp.ProcessAPI(context.Background(), api)
+	if result.HasError {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+	if result.Attempts != 2 || result.RecordCount != 1 {
+		t.Errorf("Expected 1 record after 2 attempts, got %d after %d", result.RecordCount, result.Attempts)
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	b := &circuitBreaker{
+		cfg:   config.BreakerConfig{Enabled: true, FailureThreshold: 2, SuccessThreshold: 1, CoolDown: time.Minute},
+		state: BreakerClosed,
+	}
+	now := time.Now()
+
+	b.record(false, now)
+	if !b.allow(now) || b.status().State != BreakerClosed {
+		t.Fatalf("Expected closed circuit after one failure, got %s", b.status().State)
+	}
+
+	b.record(false, now)
+	if b.allow(now.Add(30*time.Second)) || b.status().State != BreakerOpen {
+		t.Fatalf("Expected open circuit during cool-down, got %s", b.status().State)
+	}
+
+	// A single trial is admitted once the cool-down has passed
+	later := now.Add(2 * time.Minute)
+	if !b.allow(later) || b.allow(later) {
+		t.Fatal("Expected exactly one half-open trial")
+	}
+
+	// A failed trial reopens the circuit for another cool-down
+	b.record(false, later)
+	if b.status().State != BreakerOpen || b.allow(later.Add(30*time.Second)) {
+		t.Fatalf("Expected circuit to reopen, got %s", b.status().State)
+	}
+
+	// A released trial can be retried; a successful one closes the circuit
+	evenLater := later.Add(2 * time.Minute)
+	b.allow(evenLater)
+	b.release()
+	if !b.allow(evenLater) {
+		t.Fatal("Expected released trial to be admitted again")
+	}
+	b.record(true, evenLater)
+	if status := b.status(); status.State != BreakerClosed || status.ConsecutiveFailures != 0 {
+		t.Errorf("Expected closed circuit after successful trial, got %+v", status)
+	}
+}
+
+func TestProcessAPIWithOpenCircuit(t *testing.T) {
+	fp := newTestProcessor()
+
+	var calls int
+	down := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[{"id": 1}]`))
+	}))
+	defer server.Close()
+
+	api := config.APIConfig{
+		Name:        "breaker",
+		URL:         server.URL,
+		Format:      "json",
+		Compression: "none",
+		Breaker:     config.BreakerConfig{Enabled: true, FailureThreshold: 2, SuccessThreshold: 1, CoolDown: 50 * time.Millisecond},
+	}
+
+	for i := 0; i < 2; i++ {
+		if result := fp.ProcessAPI(context.Background(), api); !result.HasError || result.CircuitOpen {
+			t.Fatalf("Expected fetch error on attempt %d, got %+v", i+1, result)
+		}
+	}
+
+	result := fp.ProcessAPI(context.Background(), api)
+	if !result.CircuitOpen || result.HasError || calls != 2 {
+		t.Fatalf("Expected open circuit without contacting source, got %+v after %d calls", result, calls)
+	}
+	if state := fp.BreakerStates()["breaker"].State; state != BreakerOpen {
+		t.Errorf("Expected open state, got %s", state)
+	}
+
+	down = false
+	time.Sleep(60 * time.Millisecond)
+	result = fp.ProcessAPI(context.Background(), api)
+	if result.CircuitOpen || result.HasError || result.RecordCount != 1 {
+		t.Fatalf("Expected successful trial fetch, got %+v", result)
+	}
+	if state := fp.BreakerStates()["breaker"].State; state != BreakerClosed {
+		t.Errorf("Expected closed state after recovery, got %s", state)
+	}
+}
+
+func TestProcessAPIDeadlineAndCancellation(t *testing.T) {
+	fp := newTestProcessor()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	api := config.APIConfig{
+		Name:        "hung",
+		URL:         server.URL,
+		Format:      "json",
+		Compression: "none",
+		Deadline:    50 * time.Millisecond,
+		Breaker:     config.BreakerConfig{Enabled: true, FailureThreshold: 1, SuccessThreshold: 1, CoolDown: time.Minute},
+	}
+
+	start := time.Now()
+	result := fp.ProcessAPI(context.Background(), api)
+	if !result.TimedOut || !result.HasError || result.Cancelled {
+		t.Fatalf("Expected timed out error result, got %+v", result)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the deadline to stop the fetch, took %v", elapsed)
+	}
+	if state := fp.BreakerStates()["hung"].State; state != BreakerOpen {
+		t.Errorf("Expected a timeout to count as a failure, got %s", state)
+	}
+
+	// Cancellation is not an error and leaves the circuit alone
+	api.Name = "shutdown"
+	api.Deadline = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	result = fp.ProcessAPI(ctx, api)
+	if !result.Cancelled || result.HasError || result.TimedOut {
+		t.Fatalf("Expected cancelled result, got %+v", result)
+	}
+	if state := fp.BreakerStates()["shutdown"].State; state != BreakerClosed {
+		t.Errorf("Expected cancellation not to trip the circuit, got %s", state)
+	}
+
+	// The same applies when the staleness probe is cancelled
+	probed := api
+	probed.Name = "shutdown-probe"
+	probed.Staleness = config.StalenessConfig{Enabled: true, Threshold: time.Hour, Behavior: "skip"}
+	probeCtx, probeCancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, probeCancel)
+	result = fp.ProcessAPI(probeCtx, probed)
+	if !result.Cancelled || result.HasError || result.TimedOut {
+		t.Fatalf("Expected cancelled staleness probe result, got %+v", result)
+	}
+	if result.ProbeAttempts != 1 || result.Attempts != 0 {
+		t.Errorf("Expected the probe attempt on the result, got %d probe and %d fetch attempts", result.ProbeAttempts, result.Attempts)
+	}
+	if state := fp.BreakerStates()["shutdown-probe"].State; state != BreakerClosed {
+		t.Errorf("Expected cancelled probe not to trip the circuit, got %s", state)
+	}
+
+	// APIs still queued after cancellation are not fetched
+	api.Enabled = true
+	results := fp.ProcessAPIs(ctx, []config.APIConfig{api, api}, 1)
+	for _, r := range results {
+		if !r.Cancelled {
+			t.Errorf("Expected queued API to be cancelled, got %+v", r)
+		}
+	}
+}
+
+func TestProcessAPILimits(t *testing.T) {
+	body := "id,value\n1,a\n2,b\n3,c\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		limits        config.LimitsConfig
+		expectRecords int
+		expectError   bool
+		expectLimit   string
+	}{
+		{
+			name:          "within limits",
+			limits:        config.LimitsConfig{MaxBodyBytes: int64(len(body)), MaxRecords: 3, BodyBehavior: "error", RecordsBehavior: "error"},
+			expectRecords: 3,
+		},
+		{
+			name:        "body over limit fails",
+			limits:      config.LimitsConfig{MaxBodyBytes: 10, BodyBehavior: "error", RecordsBehavior: "truncate"},
+			expectError: true,
+			expectLimit: "max_body_bytes",
+		},
+		{
+			name:        "body over limit skipped",
+			limits:      config.LimitsConfig{MaxBodyBytes: 10, BodyBehavior: "skip", RecordsBehavior: "truncate"},
+			expectLimit: "max_body_bytes",
+		},
+		{
+			name:          "body truncated to complete lines",
+			limits:        config.LimitsConfig{MaxBodyBytes: 16, BodyBehavior: "truncate", RecordsBehavior: "truncate"},
+			expectRecords: 1,
+			expectLimit:   "max_body_bytes",
+		},
+		{
+			name:          "records truncated",
+			limits:        config.LimitsConfig{MaxRecords: 2, BodyBehavior: "error", RecordsBehavior: "truncate"},
+			expectRecords: 2,
+			expectLimit:   "max_records",
+		},
+		{
+			name:        "records skipped",
+			limits:      config.LimitsConfig{MaxRecords: 2, BodyBehavior: "error", RecordsBehavior: "skip"},
+			expectLimit: "max_records",
+		},
+		{
+			name:        "records over limit fail",
+			limits:      config.LimitsConfig{MaxRecords: 2, BodyBehavior: "error", RecordsBehavior: "error"},
+			expectError: true,
+			expectLimit: "max_records",
+		},
+		{
+			name:        "body truncated then records over limit",
+			limits:      config.LimitsConfig{MaxBodyBytes: 17, MaxRecords: 1, BodyBehavior: "truncate", RecordsBehavior: "error"},
+			expectError: true,
+			expectLimit: "max_body_bytes,max_records",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fp := newTestProcessor()
+			api := config.APIConfig{
+				Name:        "limited",
+				URL:         server.URL,
+				Format:      "csv",
+				Compression: "none",
+				CSV:         config.CSVConfig{Delimiter: ",", Comment: "#", Quotes: "strict", DefaultType: "auto"},
+				Limits:      tt.limits,
+			}
+
+			result := fp.ProcessAPI(context.Background(), api)
+			if result.HasError != tt.expectError {
+				t.Fatalf("Expected error %v, got %v (%v)", tt.expectError, result.HasError, result.Error)
+			}
+			if result.RecordCount != tt.expectRecords {
+				t.Errorf("Expected %d records, got %d", tt.expectRecords, result.RecordCount)
+			}
+
+			var limits []string
+			for _, hit := range result.Limits {
+				limits = append(limits, hit.Limit)
+			}
+			if limit := strings.Join(limits, ","); limit != tt.expectLimit {
+				t.Errorf("Expected limit %q, got %q", tt.expectLimit, limit)
+			}
+			if IsLimitError(result.Error) != tt.expectError {
+				t.Errorf("Expected limit error %v, got %v", tt.expectError, result.Error)
+			}
+		})
+	}
+}
+
+func TestProcessAPIDecompressedLimits(t *testing.T) {
+	csvBody := []byte("id,value\n" + strings.Repeat("1,a\n", 2000))
+
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(csvBody)
+	gz.Close()
+
+	encoder, _ := zstd.NewWriter(nil)
+	zstded := encoder.EncodeAll(csvBody, nil)
+	encoder.Close()
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	for _, name := range []string{"a.csv", "b.csv"} {
+		w, _ := zw.Create(name)
+		w.Write(csvBody)
+	}
+	zw.Close()
+
+	var tarball bytes.Buffer
+	gz = gzip.NewWriter(&tarball)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "rows.csv", Mode: 0644, Size: int64(len(csvBody)), ModTime: time.Now(), Typeflag: tar.TypeReg})
+	tw.Write(csvBody)
+	tw.Close()
+	gz.Close()
+
+	tests := []struct {
+		name          string
+		payload       []byte
+		compression   string
+		max           int64
+		behavior      string
+		expectRecords int
+		expectError   bool
+	}{
+		{name: "gzip bomb fails", payload: gzipped.Bytes(), compression: "gzip", max: 200, behavior: "error", expectError: true},
+		{name: "gzip truncated", payload: gzipped.Bytes(), compression: "gzip", max: 200, behavior: "truncate", expectRecords: 47},
+		{name: "zstd bomb fails", payload: zstded, compression: "zstd", max: 200, behavior: "error", expectError: true},
+		{name: "zip members share the limit", payload: zipped.Bytes(), compression: "zip", max: int64(len(csvBody)) + 200, behavior: "truncate", expectRecords: 2047},
+		{name: "zip bomb skipped", payload: zipped.Bytes(), compression: "zip", max: 400, behavior: "skip"},
+		{name: "compressed tarball truncated", payload: tarball.Bytes(), compression: "gzip", max: 2000, behavior: "truncate", expectRecords: 369},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if int64(len(tt.payload)) > tt.max {
+				t.Fatalf("Compressed payload of %d bytes must fit in %d", len(tt.payload), tt.max)
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(tt.payload)
+			}))
+			defer server.Close()
+
+			api := config.APIConfig{
+				Name:        "compressed",
+				URL:         server.URL,
+				Format:      "csv",
+				Compression: tt.compression,
+				CSV:         config.CSVConfig{Delimiter: ",", Comment: "#", Quotes: "strict", DefaultType: "auto"},
+				Limits:      config.LimitsConfig{MaxBodyBytes: tt.max, BodyBehavior: tt.behavior, RecordsBehavior: "truncate"},
+			}
+
+			result := newTestProcessor().ProcessAPI(context.Background(), api)
+			if result.HasError != tt.expectError {
+				t.Fatalf("Expected error %v, got %v (%v)", tt.expectError, result.HasError, result.Error)
+			}
+			if result.RecordCount != tt.expectRecords {
+				t.Errorf("Expected %d records, got %d", tt.expectRecords, result.RecordCount)
+			}
+			if len(result.Limits) != 1 || result.Limits[0].Limit != "max_body_bytes" {
+				t.Errorf("Expected max_body_bytes limit hit, got %+v", result.Limits)
+			}
+		})
+	}
+}
+func TestProcessAPISchemaValidation(t *testing.T) {
+	dir := t.TempDir()
+	schemaFile := dir + "/order.json"
+	schema := `{
+		"type": "object",
+		"required": ["id", "amount"],
+		"properties": {
+			"id": {"type": "integer"},
+			"amount": {"type": "number", "minimum": 0}
+		}
+	}`
+	if err := os.WriteFile(schemaFile, []byte(schema), 0o644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"id": 1, "amount": 9.5}, {"id": 2, "amount": -1}, {"id": "three"}]`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		mode          string
+		expectRecords int
+	}{
+		{mode: "drop", expectRecords: 1},
+		{mode: "tag", expectRecords: 3},
+		{mode: "quarantine", expectRecords: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			fp := newTestProcessor()
+			api := config.APIConfig{
+				Name:        "orders/" + tt.mode,
+				URL:         server.URL,
+				Format:      "json",
+				Compression: "none",
+				Schema: config.SchemaConfig{
+					File:          schemaFile,
+					Invalid:       tt.mode,
+					QuarantineDir: dir + "/quarantine",
+				},
+			}
+
+			result := fp.ProcessAPI(context.Background(), api)
+			if result.HasError {
+				t.Fatalf("Unexpected error: %v", result.Error)
+			}
+			if result.RecordCount != tt.expectRecords || result.InvalidRecords != 2 {
+				t.Errorf("Expected %d records and 2 invalid, got %d and %d", tt.expectRecords, result.RecordCount, result.InvalidRecords)
+			}
+
+			tagged := 0
+			for _, sample := range result.Samples {
+				if violations, ok := sample["validation.errors"].(string); ok {
+					tagged++
+					if !strings.Contains(violations, "/") {
+						t.Errorf("Expected violations to name a location, got %q", violations)
+					}
+				}
+			}
+			if (tt.mode == "tag") != (tagged == 2) {
+				t.Errorf("Expected tagged samples only in tag mode, got %d", tagged)
+			}
+
+			if tt.mode == "quarantine" {
+				data, err := os.ReadFile(dir + "/quarantine/orders_quarantine.jsonl")
+				if err != nil {
+					t.Fatalf("Expected quarantine file: %v", err)
+				}
+				if lines := strings.Count(string(data), "\n"); lines != 2 {
+					t.Errorf("Expected 2 quarantined records, got %d", lines)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessAPIDedupe(t *testing.T) {
+	stateDir := t.TempDir()
+	body := `[{"id": 1, "status": "open"}, {"id": 2, "status": "open"}, {"id": 1, "status": "open"}]`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	var failing int32
+	newRelic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer newRelic.Close()
+
+	newProcessor := func() *FileProcessor {
+		fp := newTestProcessor()
+		fp.metricsCollector = metrics.NewCollector(config.NewRelicConfig{AccountID: "1", EventsURL: newRelic.URL + "/accounts/%s/events"}, fp.logger)
+		return fp
+	}
+
+	api := config.APIConfig{
+		Name:        "tickets",
+		URL:         server.URL,
+		Format:      "json",
+		Compression: "none",
+		Dedupe:      config.DedupeConfig{Enabled: true, Keys: []string{"id"}, TTL: time.Hour, StateDir: stateDir},
+		Schedule:    config.ScheduleConfig{Interval: 10 * time.Second},
+	}
+
+	// A repeat inside the payload is suppressed
+	fp := newProcessor()
+	if result := fp.ProcessAPI(context.Background(), api); result.RecordCount != 2 || result.Duplicates != 1 {
+		t.Fatalf("Expected 2 new records, got %d (%d duplicates)", result.RecordCount, result.Duplicates)
+	}
+	// A second scheduled run before the 60s flush suppresses the queued records
+	if result := fp.ProcessAPI(context.Background(), api); result.RecordCount != 0 || result.Duplicates != 3 {
+		t.Fatalf("Expected queued records suppressed, got %d (%d duplicates)", result.RecordCount, result.Duplicates)
+	}
+	if _, err := os.Stat(filepath.Join(stateDir, "dedupe", "tickets.json")); err == nil {
+		t.Fatal("Expected no saved state before the flush")
+	}
+	if err := fp.metricsCollector.SendEvents(context.Background()); err != nil {
+		t.Fatalf("Unexpected flush error: %v", err)
+	}
+	if result := fp.ProcessAPI(context.Background(), api); result.RecordCount != 0 || result.Duplicates != 3 {
+		t.Fatalf("Expected all records suppressed, got %d (%d duplicates)", result.RecordCount, result.Duplicates)
+	}
+
+	// State survives a restart; changed and appended records are sent
+	body = `[{"id": 1, "status": "open"}, {"id": 2, "status": "closed"}, {"id": 3, "status": "open"}]`
+	fp = newProcessor()
+	result := fp.ProcessAPI(context.Background(), api)
+	if result.RecordCount != 2 || result.Duplicates != 1 {
+		t.Fatalf("Expected the changed and new record, got %d (%d duplicates)", result.RecordCount, result.Duplicates)
+	}
+	for _, sample := range result.Samples {
+		if sample["id"] == float64(1) {
+			t.Errorf("Expected unchanged record to be suppressed, got %v", sample)
+		}
+	}
+
+	// Records lost with a failed flush are not suppressed
+	atomic.StoreInt32(&failing, 1)
+	if err := fp.metricsCollector.SendEvents(context.Background()); err == nil {
+		t.Fatal("Expected the flush to fail")
+	}
+	if result := fp.ProcessAPI(context.Background(), api); result.RecordCount != 2 {
+		t.Fatalf("Expected records lost with the flush to be sent again, got %d (%d duplicates)", result.RecordCount, result.Duplicates)
+	}
+	atomic.StoreInt32(&failing, 0)
+	if err := fp.metricsCollector.SendEvents(context.Background()); err != nil {
+		t.Fatalf("Unexpected flush error: %v", err)
+	}
+	if result := fp.ProcessAPI(context.Background(), api); result.RecordCount != 0 || result.Duplicates != 3 {
+		t.Fatalf("Expected all records suppressed after the retry, got %d (%d duplicates)", result.RecordCount, result.Duplicates)
+	}
+
+	// Entries expire after the TTL
+	api.Dedupe.TTL = time.Nanosecond
+	if result := fp.ProcessAPI(context.Background(), api); result.RecordCount != 3 {
+		t.Errorf("Expected expired records to be sent again, got %d", result.RecordCount)
+	}
+}
+
+func TestProcessAPITransforms(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"user": {"email": "ada@example.com", "id": "7"}, "debug": "x"}]`))
+	}))
+	defer server.Close()
+
+	api := config.APIConfig{
+		Name:        "users",
+		URL:         server.URL,
+		Format:      "json",
+		Compression: "none",
+		Flatten:     config.FlattenConfig{Enabled: true, Separator: ".", MaxDepth: 5, MaxKeyLength: 255},
+		Transforms: []config.TransformConfig{
+			{Type: "drop", Fields: []string{"debug"}},
+			{Type: "replace", Fields: []string{"user.email"}, Pattern: `^[^@]+`, Replacement: "***"},
+			{Type: "cast", Fields: []string{"user.id"}, To: "int"},
+			{Type: "rename", Field: "user.id", To: "user_id"},
+		},
+	}
+
+	result := newTestProcessor().ProcessAPI(context.Background(), api)
+	if result.HasError {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+
+	sample := result.Samples[0]
+	if _, ok := sample["debug"]; ok {
+		t.Error("Expected debug to be dropped")
+	}
+	if sample["user.email"] != "***@example.com" {
+		t.Errorf("Expected masked email, got %v", sample["user.email"])
+	}
+	if sample["user_id"] != int64(7) {
+		t.Errorf("Expected user_id 7, got %v (%T)", sample["user_id"], sample["user_id"])
+	}
+	// Transforms run after custom attributes are added
+	if sample["api.name"] != "users" {
+		t.Errorf("Expected api.name to be kept, got %v", sample["api.name"])
+	}
+}
+
+func TestProcessAPIEnrich(t *testing.T) {
+	dir := t.TempDir()
+	owners := filepath.Join(dir, "owners.csv")
+	tiers := filepath.Join(dir, "tiers.json")
+	if err := os.WriteFile(owners, []byte("service_id,team,tier\nsvc-1,payments,1\nsvc-2,search,2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tiers, []byte(`{"1": {"pager": true}, "2": {"pager": false}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"service_id": "svc-1"}, {"service_id": "svc-2"}, {"service_id": "svc-9"}]`))
+	}))
+	defer server.Close()
+
+	api := config.APIConfig{
+		Name:        "services",
+		URL:         server.URL,
+		Format:      "json",
+		Compression: "none",
+		Attributes:  map[string]string{"team": "platform"},
+		Enrich: []config.EnrichConfig{
+			{Field: "service_id", File: owners, Key: "service_id", OnMiss: "default", Defaults: map[string]string{"team": "unowned"}},
+			{Field: "tier", File: tiers, Key: "tier", Prefix: "tier.", OnMiss: "default"},
+		},
+	}
+
+	fp := newTestProcessor()
+	result := fp.ProcessAPI(context.Background(), api)
+	if result.HasError || len(result.Samples) != 3 {
+		t.Fatalf("Expected 3 samples, got %d: %v", len(result.Samples), result.Error)
+	}
+	first := result.Samples[0]
+	// Custom attributes are added after enrichment and take precedence
+	if first["tier"] != "1" || first["tier.pager"] != true || first["team"] != "platform" {
+		t.Errorf("Expected enriched sample, got %v", first)
+	}
+	if result.Samples[2]["tier"] != nil {
+		t.Errorf("Expected miss without defaults to add nothing, got %v", result.Samples[2])
+	}
+
+	// Misses are dropped with the drop policy
+	delete(api.Attributes, "team")
+	api.Enrich[0].OnMiss = "drop"
+	result = fp.ProcessAPI(context.Background(), api)
+	if len(result.Samples) != 2 {
+		t.Fatalf("Expected the unknown service to be dropped, got %d samples", len(result.Samples))
+	}
+
+	// Edits to the table are picked up on the next run
+	if err := os.WriteFile(owners, []byte("service_id,team,tier\nsvc-1,billing,1\nsvc-9,labs,3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result = fp.ProcessAPI(context.Background(), api)
+	if len(result.Samples) != 2 || result.Samples[0]["team"] != "billing" || result.Samples[1]["team"] != "labs" {
+		t.Errorf("Expected reloaded table, got %v", result.Samples)
+	}
+}
+
+func TestRecordIdentity(t *testing.T) {
+	a := map[string]interface{}{"id": 1, "value": "x", "processed.timestamp": 1}
+	b := map[string]interface{}{"id": 1, "value": "x", "processed.timestamp": 2}
+	c := map[string]interface{}{"id": 1, "value": "y", "processed.timestamp": 3}
+
+	keyA, hashA := recordIdentity(a, nil)
+	keyB, hashB := recordIdentity(b, nil)
+	if keyA != keyB || hashA != hashB {
+		t.Error("Expected the processing timestamp to be ignored")
+	}
+
+	keyA, hashA = recordIdentity(a, []string{"id"})
+	keyC, hashC := recordIdentity(c, []string{"id"})
+	if keyA != keyC || hashA == hashC {
+		t.Error("Expected same key with a different content hash")
+	}
+	if keyC, _ = recordIdentity(c, nil); keyC == keyA {
+		t.Error("Expected whole-record key to differ from field key")
+	}
+}
+
+func TestApplyRates(t *testing.T) {
+	fp := newTestProcessor()
+	api := config.APIConfig{
+		Name:  "counters",
+		Rates: config.RateConfig{Fields: []string{"requests_total"}, Metrics: true},
+	}
+	start := time.Now()
+
+	run := func(at time.Time, values map[string]interface{}) []map[string]interface{} {
+		var samples []map[string]interface{}
+		for _, host := range []string{"a", "b"} {
+			if v, ok := values[host]; ok {
+				samples = append(samples, map[string]interface{}{"host": host, "requests_total": v})
+			}
+		}
+		fp.applyRates(api, samples, at)
+		return samples
+	}
+
+	// The first observation has nothing to compare against
+	samples := run(start, map[string]interface{}{"a": float64(100), "b": int64(50)})
+	if _, ok := samples[0]["requests_total.rate"]; ok {
+		t.Error("Expected no rate on the first run")
+	}
+
+	samples = run(start.Add(10*time.Second), map[string]interface{}{"a": float64(150), "b": int64(20)})
+	if samples[0]["requests_total.delta"] != float64(50) || samples[0]["requests_total.rate"] != float64(5) {
+		t.Errorf("Expected delta 50 and rate 5, got %v", samples[0])
+	}
+	// A lower value is a reset, so the whole new value is the delta
+	if samples[1]["requests_total.delta"] != float64(20) || samples[1]["requests_total.rate"] != float64(2) {
+		t.Errorf("Expected reset with delta 20 and rate 2, got %v", samples[1])
+	}
+
+	// Series missing from a run start over when they return
+	run(start.Add(20*time.Second), map[string]interface{}{"a": float64(160)})
+	samples = run(start.Add(30*time.Second), map[string]interface{}{"a": float64(170), "b": int64(40)})
+	if samples[0]["requests_total.delta"] != float64(10) {
+		t.Errorf("Expected delta 10, got %v", samples[0])
+	}
+	if _, ok := samples[1]["requests_total.delta"]; ok {
+		t.Errorf("Expected returning series to start over, got %v", samples[1])
+	}
+}
+
+func TestApplyRatesEventTime(t *testing.T) {
+	fp := newTestProcessor()
+	api := config.APIConfig{
+		Name:      "slow-source",
+		Rates:     config.RateConfig{Fields: []string{"requests_total"}},
+		Timestamp: config.TimestampConfig{Field: "observed_at"},
+	}
+	updated := time.Now().Add(-10 * time.Minute)
+
+	run := func(polled, observed time.Time, value float64) map[string]interface{} {
+		sample := map[string]interface{}{
+			"host":           "a",
+			"observed_at":    observed.Format(time.RFC3339),
+			"generated":      polled.Format(time.RFC3339Nano),
+			"uptime":         fmt.Sprint(polled.Unix()),
+			"requests_total": value,
+			"timestamp":      observed.UnixMilli(),
+		}
+		fp.applyRates(api, []map[string]interface{}{sample}, polled)
+		return sample
+	}
+
+	run(updated, updated, 100)
+	// Polled again before the source updated: no zero rate
+	if sample := run(updated.Add(30*time.Second), updated, 100); sample["requests_total.rate"] != nil {
+		t.Errorf("Expected no rate for an unchanged reading, got %v", sample["requests_total.rate"])
+	}
+	// Timestamps and numeric strings do not split the series, and the rate
+	// uses the five minutes between readings, not the poll interval
+	sample := run(updated.Add(5*time.Minute+time.Second), updated.Add(5*time.Minute), 400)
+	if sample["requests_total.delta"] != float64(300) || sample["requests_total.rate"] != float64(1) {
+		t.Errorf("Expected delta 300 and rate 1, got %v", sample)
+	}
+}
+
+func TestApplyTimestamps(t *testing.T) {
+	fp := newTestProcessor()
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	api := config.APIConfig{
+		Name: "events",
+		Timestamp: config.TimestampConfig{
+			Field:    "observed_at",
+			Layout:   "2006-01-02 15:04:05",
+			Timezone: "Europe/Berlin",
+			Unit:     "ms",
+		},
+	}
+
+	samples := []map[string]interface{}{
+		{"id": "layout", "observed_at": "2024-03-10 12:30:00"},
+		{"id": "epoch", "observed_at": float64(now.Add(-time.Hour).UnixMilli())},
+		{"id": "old", "observed_at": now.Add(-72 * time.Hour).UnixMilli()},
+		{"id": "future", "observed_at": now.Add(time.Hour).UnixMilli()},
+		{"id": "garbage", "observed_at": "yesterday"},
+		{"id": "missing"},
+	}
+
+	result := &ProcessResult{}
+	kept := fp.applyTimestamps(api, samples, result, now)
+	if result.RejectedTimestamps != 2 {
+		t.Errorf("Expected 2 rejected timestamps, got %d", result.RejectedTimestamps)
+	}
+	if len(kept) != 4 {
+		t.Fatalf("Expected 4 samples, got %d", len(kept))
+	}
+
+	// 12:30 in Berlin is 11:30 UTC
+	if kept[0]["timestamp"] != now.Add(-30*time.Minute).UnixMilli() {
+		t.Errorf("Expected layout timestamp in Berlin time, got %v", kept[0]["timestamp"])
+	}
+	if kept[1]["timestamp"] != now.Add(-time.Hour).UnixMilli() {
+		t.Errorf("Expected epoch milliseconds, got %v", kept[1]["timestamp"])
+	}
+	for _, sample := range kept[2:] {
+		if _, ok := sample["timestamp"]; ok {
+			t.Errorf("Expected %v to keep the ingestion time", sample["id"])
+		}
+	}
+}
+
+func TestParseEventTimeUnits(t *testing.T) {
+	want := time.Unix(1700000000, 0)
+	tests := []struct {
+		value interface{}
+		unit  string
+	}{
+		{int64(1700000000), "s"},
+		{"1700000000", "s"},
+		{float64(1700000000000), "ms"},
+		{"1700000000000000000", "ns"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseEventTime(tt.value, config.TimestampConfig{Unit: tt.unit}, time.UTC)
+		if err != nil {
+			t.Errorf("parseEventTime(%v, %s) failed: %v", tt.value, tt.unit, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("parseEventTime(%v, %s) = %v, want %v", tt.value, tt.unit, got, want)
+		}
+	}
+}
+
+func TestApplyDerive(t *testing.T) {
+	fp := newTestProcessor()
+	api := config.APIConfig{
+		Name: "requests",
+		Derive: []config.DeriveConfig{
+			{Name: "error_rate", Expr: "total > 0 ? errors / total : 0"},
+			{Name: "status_class", Expr: `status >= 500 ? "5xx" : status >= 400 ? "4xx" : "ok"`},
+			{Name: "route", Expr: `upper($env["http.method"]) + " " + trimPrefix(path, "/api")`},
+			{Name: "degraded", Expr: `error_rate > 0.1 && status_class != "ok"`},
+		},
+	}
+
+	samples := []map[string]interface{}{
+		{"errors": float64(3), "total": float64(20), "status": float64(503), "http.method": "get", "path": "/api/orders"},
+		{"errors": float64(0), "total": float64(0), "status": float64(200), "http.method": "post", "path": "/api/cart"},
+		{"status": "unknown"},
+	}
+	if err := fp.applyDerive(api, samples); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []map[string]interface{}{
+		{"error_rate": 0.15, "status_class": "5xx", "route": "GET /orders", "degraded": true},
+		{"error_rate": 0, "status_class": "ok", "route": "POST /cart", "degraded": false},
+	}
+	for i, want := range expected {
+		for k, v := range want {
+			if fmt.Sprint(samples[i][k]) != fmt.Sprint(v) {
+				t.Errorf("Sample %d: expected %s=%v, got %v (%T)", i, k, v, samples[i][k], samples[i][k])
+			}
+		}
+	}
+
+	// Comparing a string with a number is a type error, so nothing is set
+	if _, ok := samples[2]["status_class"]; ok {
+		t.Errorf("Expected failed expression to leave status_class unset, got %v", samples[2]["status_class"])
+	}
+}
+
+func TestApplyDeriveNonFinite(t *testing.T) {
+	fp := newTestProcessor()
+	api := config.APIConfig{
+		Name:   "requests",
+		Derive: []config.DeriveConfig{{Name: "error_rate", Expr: "errors / total"}},
+	}
+
+	samples := []map[string]interface{}{
+		{"errors": float64(0), "total": float64(0)},
+		{"errors": float64(3), "total": float64(0)},
+		{"errors": float64(1), "total": float64(4)},
+	}
+	if err := fp.applyDerive(api, samples); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, sample := range samples[:2] {
+		if value, ok := sample["error_rate"]; ok {
+			t.Errorf("Expected division by zero to leave error_rate unset, got %v", value)
+		}
+	}
+	if samples[2]["error_rate"] != 0.25 {
+		t.Errorf("Expected error_rate 0.25, got %v", samples[2]["error_rate"])
+	}
+
+	// The batch must still encode
+	if _, err := json.Marshal(samples); err != nil {
+		t.Errorf("Expected samples to encode, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+)
+
+// flattenFields converts nested maps and arrays into dotted attribute keys.
+// Values nested deeper than MaxDepth are kept as JSON strings.
+func flattenFields(fields map[string]interface{}, cfg config.FlattenConfig) map[string]interface{} {
+	flat := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		flattenValue(flat, k, v, 1, cfg)
+	}
+	return limitKeys(flat, cfg.MaxKeyLength)
+}
+
+// flattenValue writes value under key into flat, descending into maps and arrays
+func flattenValue(flat map[string]interface{}, key string, value interface{}, depth int, cfg config.FlattenConfig) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if depth >= cfg.MaxDepth {
+			flat[key] = encodeJSONValue(v)
+			return
+		}
+		for k, child := range v {
+			flattenValue(flat, key+cfg.Separator+k, child, depth+1, cfg)
+		}
+	case []interface{}:
+		switch strings.ToLower(cfg.Arrays) {
+		case "drop":
+			return
+		case "join":
+			parts := make([]string, 0, len(v))
+			for _, item := range v {
+				parts = append(parts, scalarString(item))
+			}
+			flat[key] = strings.Join(parts, cfg.JoinSeparator)
+		default:
+			if depth >= cfg.MaxDepth {
+				flat[key] = encodeJSONValue(v)
+				return
+			}
+			for i, child := range v {
+				flattenValue(flat, key+cfg.Separator+strconv.Itoa(i), child, depth+1, cfg)
+			}
+		}
+	default:
+		flat[key] = v
+	}
+}
+
+// limitKeys truncates keys longer than max bytes. A truncated key that would
+// collide with another key ends in a short hash of the full key instead, so
+// neither value is lost.
+func limitKeys(flat map[string]interface{}, max int) map[string]interface{} {
+	if max <= 0 {
+		return flat
+	}
+
+	counts := make(map[string]int, len(flat))
+	for k := range flat {
+		counts[truncateKey(k, max)]++
+	}
+
+	limited := make(map[string]interface{}, len(flat))
+	for k, v := range flat {
+		short := truncateKey(k, max)
+		if short != k && counts[short] > 1 {
+			short = hashedKey(k, max)
+		}
+		limited[short] = v
+	}
+	return limited
+}
+
+// truncateKey cuts key to at most max bytes without splitting a UTF-8 rune
+func truncateKey(key string, max int) string {
+	if len(key) <= max {
+		return key
+	}
+	end := max
+	for end > 0 && !utf8.RuneStart(key[end]) {
+		end--
+	}
+	return key[:end]
+}
+
+// hashedKey truncates key to max bytes ending in "~" and 8 hex digits of its
+// hash
+func hashedKey(key string, max int) string {
+	suffix := "~" + hashString(key)[:8]
+	if max <= len(suffix) {
+		return suffix[len(suffix)-max:]
+	}
+	return truncateKey(key, max-len(suffix)) + suffix
+}
+
+// scalarString renders a value for joining, using JSON for nested values
+func scalarString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		return encodeJSONValue(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// encodeJSONValue encodes a nested value as a JSON string attribute
+func encodeJSONValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,100 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+)
+
+// jqVariableNames lists the variables available to every JQ program, in the
+// same order as the values returned by jqVariableValues
+var jqVariableNames = []string{"$api", "$attrs", "$env", "$now"}
+
+// jqVariableValues builds the variable values for a JQ program run
+func jqVariableValues(api config.APIConfig, fetchedAt time.Time) []interface{} {
+	attrs := make(map[string]interface{}, len(api.Attributes))
+	for k, v := range api.Attributes {
+		attrs[k] = v
+	}
+
+	env := make(map[string]interface{})
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+
+	return []interface{}{
+		api.Name,
+		attrs,
+		env,
+		float64(fetchedAt.UnixNano()) / float64(time.Second),
+	}
+}
+
+// jqCompilerOptions returns the variables and helper functions registered with JQ programs
+func jqCompilerOptions() []gojq.CompilerOption {
+	return []gojq.CompilerOption{
+		gojq.WithVariables(jqVariableNames),
+		gojq.WithFunction("parse_duration", 0, 0, jqParseDuration),
+		gojq.WithFunction("to_epoch", 1, 1, jqToEpoch),
+		gojq.WithFunction("sha256", 0, 0, jqSHA256),
+	}
+}
+
+// jqParseDuration converts a Go duration string such as "1m30s" into seconds
+func jqParseDuration(v interface{}, _ []interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("parse_duration cannot be applied to %T", v)
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("parse_duration: %w", err)
+	}
+	return d.Seconds()
+}
+
+// jqToEpoch parses a time string with the given Go layout and returns Unix seconds
+func jqToEpoch(v interface{}, args []interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("to_epoch cannot be applied to %T", v)
+	}
+
+	layout, ok := args[0].(string)
+	if !ok {
+		return fmt.Errorf("to_epoch layout must be a string, got %T", args[0])
+	}
+
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return fmt.Errorf("to_epoch: %w", err)
+	}
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// jqSHA256 returns the hex SHA-256 digest of a string, or of the JSON encoding of any other value
+func jqSHA256(v interface{}, _ []interface{}) interface{} {
+	var data []byte
+	if s, ok := v.(string); ok {
+		data = []byte(s)
+	} else {
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("sha256: %w", err)
+		}
+		data = encoded
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
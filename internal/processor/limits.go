@@ -0,0 +1,91 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// LimitHit describes a response size or record limit an API exceeded
+type LimitHit struct {
+	Limit    string // max_body_bytes or max_records
+	Max      int64
+	Observed int64 // records or bytes seen; 0 when the body size is unknown
+	Behavior string
+}
+
+// limitError reports an exceeded limit from the fetch path
+type limitError struct {
+	hit LimitHit
+}
+
+// Error implements error
+func (e *limitError) Error() string {
+	if e.hit.Limit == "max_records" {
+		return fmt.Sprintf("%d records exceed max_records of %d", e.hit.Observed, e.hit.Max)
+	}
+	return fmt.Sprintf("response exceeds %s of %d", e.hit.Limit, e.hit.Max)
+}
+
+// IsLimitError reports whether err was caused by an exceeded limit with the
+// error behavior. Such errors are already reported by a limit alert.
+func IsLimitError(err error) bool {
+	return errors.As(err, new(*limitError))
+}
+
+// readBody reads a response body of at most max bytes, or without limit when
+// max is 0. A larger body returns a *limitError; with the truncate behavior
+// the bytes that fit, cut back to the last complete line, are returned with it.
+func readBody(resp *http.Response, max int64, behavior string) ([]byte, error) {
+	data, err := io.ReadAll(limitReader(resp.Body, max))
+	if err != nil {
+		return nil, err
+	}
+
+	observed := int64(0)
+	if resp.ContentLength > 0 {
+		observed = resp.ContentLength
+	}
+	return limitBytes(data, max, observed, behavior)
+}
+
+// limitReader reads one byte past max so that limitBytes can tell a body that
+// fits exactly from one that is too large
+func limitReader(r io.Reader, max int64) io.Reader {
+	if max <= 0 {
+		return r
+	}
+	return io.LimitReader(r, max+1)
+}
+
+// limitBytes applies max_body_bytes to data as described for readBody
+func limitBytes(data []byte, max, observed int64, behavior string) ([]byte, error) {
+	if max <= 0 || int64(len(data)) <= max {
+		return data, nil
+	}
+
+	hit := &limitError{hit: LimitHit{Limit: "max_body_bytes", Max: max, Observed: observed, Behavior: behavior}}
+	if behavior != "truncate" {
+		return nil, hit
+	}
+	data = data[:max]
+	return data[:bytes.LastIndexByte(data, '\n')+1], hit
+}
+
+// recordLimit notes an exceeded limit on the result and reports it as a metric
+func (fp *FileProcessor) recordLimit(api config.APIConfig, result *ProcessResult, hit LimitHit) {
+	result.Limits = append(result.Limits, hit)
+	fp.metricsCollector.RecordLimitExceeded(api.Name, hit.Limit, hit.Behavior)
+	fp.logger.WithFields(logrus.Fields{
+		"api":      api.Name,
+		"limit":    hit.Limit,
+		"max":      hit.Max,
+		"observed": hit.Observed,
+		"behavior": hit.Behavior,
+	}).Warn("API exceeded a configured limit")
+}
@@ -0,0 +1,248 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// fetchPages follows the API's pagination strategy and returns the records
+// from all pages concatenated into a single JSON array, together with the
+// total number of HTTP attempts across pages
+func (fp *FileProcessor) fetchPages(ctx context.Context, api config.APIConfig) ([]byte, int, error) {
+	p := api.Pagination
+	strategy := strings.ToLower(p.Type)
+
+	var cursorCode *gojq.Code
+	if strategy == "cursor" {
+		query, err := gojq.Parse(p.CursorQuery)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to parse cursor_query: %w", err)
+		}
+		if cursorCode, err = gojq.Compile(query, jqCompilerOptions()...); err != nil {
+			return nil, 0, fmt.Errorf("failed to compile cursor_query: %w", err)
+		}
+	}
+
+	pageURL := api.URL
+	offset := 0
+	pageNumber := p.StartPage
+	switch strategy {
+	case "offset":
+		pageURL = withQuery(api.URL, map[string]string{
+			p.OffsetParam: "0",
+			p.LimitParam:  strconv.Itoa(p.Limit),
+		})
+	case "page":
+		pageURL = withQuery(api.URL, map[string]string{
+			p.PageParam:  strconv.Itoa(pageNumber),
+			p.LimitParam: strconv.Itoa(p.Limit),
+		})
+	}
+
+	records := make([]interface{}, 0)
+	lastCursor := ""
+	attempts := 0
+	for page := 1; ; page++ {
+		pageAPI := api
+		pageAPI.URL = pageURL
+		// Configured headers and query parameters often carry credentials
+		// meant for the API's own host, so they are not sent to another one
+		if config.HostOf(pageURL) != config.HostOf(api.URL) {
+			pageAPI.Request.Headers = nil
+			pageAPI.Request.Query = nil
+		}
+
+		start := time.Now()
+		data, header, pageAttempts, err := fp.fetchResponse(ctx, pageAPI)
+		attempts += pageAttempts
+		if err != nil {
+			return nil, attempts, fmt.Errorf("page %d: %w", page, err)
+		}
+		latency := time.Since(start)
+
+		var doc interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, attempts, fmt.Errorf("page %d: failed to parse JSON: %w", page, err)
+		}
+		pageRecords := extractPageRecords(doc, p.RecordsPath)
+
+		fp.metricsCollector.RecordPageMetrics(api.Name, page, latency, len(pageRecords))
+		fp.logger.WithFields(logrus.Fields{
+			"api":          api.Name,
+			"page":         page,
+			"record_count": len(pageRecords),
+			"latency":      latency,
+		}).Debug("Fetched page")
+
+		records = append(records, pageRecords...)
+		if p.MaxRecords > 0 && len(records) >= p.MaxRecords {
+			records = records[:p.MaxRecords]
+			fp.logger.WithFields(logrus.Fields{
+				"api":         api.Name,
+				"max_records": p.MaxRecords,
+			}).Info("Reached max_records, stopping pagination")
+			break
+		}
+
+		// Work out the next page; an empty URL means this was the last one
+		next := ""
+		switch strategy {
+		case "link":
+			next = nextLink(header.Values("Link"), pageURL)
+		case "cursor":
+			cursor, err := runCursorQuery(cursorCode, doc, api)
+			if err != nil {
+				return nil, attempts, fmt.Errorf("page %d: %w", page, err)
+			}
+			// A repeated cursor would loop forever
+			if cursor != "" && cursor != lastCursor {
+				lastCursor = cursor
+				if strings.HasPrefix(cursor, "http://") || strings.HasPrefix(cursor, "https://") {
+					next = cursor
+				} else {
+					next = withQuery(api.URL, map[string]string{p.CursorParam: cursor})
+				}
+			}
+		case "offset":
+			if len(pageRecords) > 0 && len(pageRecords) >= p.Limit {
+				offset += len(pageRecords)
+				next = withQuery(api.URL, map[string]string{
+					p.OffsetParam: strconv.Itoa(offset),
+					p.LimitParam:  strconv.Itoa(p.Limit),
+				})
+			}
+		case "page":
+			if len(pageRecords) > 0 && len(pageRecords) >= p.Limit {
+				pageNumber++
+				next = withQuery(api.URL, map[string]string{
+					p.PageParam:  strconv.Itoa(pageNumber),
+					p.LimitParam: strconv.Itoa(p.Limit),
+				})
+			}
+		}
+
+		if next == "" {
+			break
+		}
+		if page >= p.MaxPages {
+			fp.logger.WithFields(logrus.Fields{
+				"api":       api.Name,
+				"max_pages": p.MaxPages,
+			}).Warn("Reached max_pages with more pages available")
+			break
+		}
+		pageURL = next
+	}
+
+	data, err := json.Marshal(records)
+	return data, attempts, err
+}
+
+// extractPageRecords returns the records held in a page. Without a records
+// path an array page is used as is and an object page is a single record.
+func extractPageRecords(doc interface{}, recordsPath string) []interface{} {
+	if recordsPath != "" {
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value, ok := lookupPath(obj, recordsPath)
+		if !ok {
+			return nil
+		}
+		doc = value
+	}
+
+	switch v := doc.(type) {
+	case []interface{}:
+		return v
+	case nil:
+		return nil
+	default:
+		return []interface{}{v}
+	}
+}
+
+// runCursorQuery evaluates the cursor query against a page. Null, false and
+// empty results mean there are no more pages.
+func runCursorQuery(code *gojq.Code, doc interface{}, api config.APIConfig) (string, error) {
+	iter := code.Run(doc, jqVariableValues(api, time.Now())...)
+	v, ok := iter.Next()
+	if !ok {
+		return "", nil
+	}
+	if err, ok := v.(error); ok {
+		return "", fmt.Errorf("cursor_query error: %w", err)
+	}
+
+	switch v.(type) {
+	case nil, bool:
+		return "", nil
+	default:
+		return scalarString(v), nil
+	}
+}
+
+// nextLink finds the rel="next" target in Link headers, resolved against the
+// current page URL
+func nextLink(headers []string, current string) string {
+	for _, header := range headers {
+		for _, link := range strings.Split(header, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			target = target[1 : len(target)-1]
+
+			for _, param := range parts[1:] {
+				name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+				if !found || strings.ToLower(strings.TrimSpace(name)) != "rel" {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(value, `"`)) {
+					if strings.ToLower(rel) == "next" {
+						return resolveURL(current, target)
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// resolveURL resolves a possibly relative reference against base
+func resolveURL(base, ref string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return baseURL.ResolveReference(refURL).String()
+}
+
+// withQuery returns rawURL with the given query parameters set
+func withQuery(rawURL string, params map[string]string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := parsed.Query()
+	for name, value := range params {
+		query.Set(name, value)
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
@@ -0,0 +1,272 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// promSeries is a single sample line from the Prometheus text exposition format
+type promSeries struct {
+	Name      string
+	Type      string
+	Help      string
+	Labels    map[string]string
+	Value     float64
+	Timestamp time.Time
+}
+
+// processPrometheus parses Prometheus text exposition into one record per series
+// and runs the records through the regular JQ and conversion pipeline. It also
+// returns the newest sample timestamp for payload-based staleness checks.
+func (fp *FileProcessor) processPrometheus(data []byte, api config.APIConfig, fetchedAt time.Time) ([]map[string]interface{}, time.Time, error) {
+	series, err := parsePrometheusText(data)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to parse Prometheus exposition: %w", err)
+	}
+
+	var newest time.Time
+	records := make([]interface{}, 0, len(series))
+	for _, s := range series {
+		// NaN and infinities cannot be encoded for New Relic
+		if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+			fp.logger.WithFields(logrus.Fields{
+				"api":    api.Name,
+				"metric": s.Name,
+			}).Debug("Skipping non-finite Prometheus sample")
+			continue
+		}
+
+		record := make(map[string]interface{}, len(s.Labels)+5)
+		for k, v := range s.Labels {
+			record[k] = v
+		}
+		record["metric.name"] = s.Name
+		record["metric.type"] = s.Type
+		record["metric.value"] = s.Value
+		if s.Help != "" {
+			record["metric.help"] = s.Help
+		}
+		if !s.Timestamp.IsZero() {
+			record["metric.timestamp"] = s.Timestamp.UnixMilli()
+			if s.Timestamp.After(newest) {
+				newest = s.Timestamp
+			}
+		}
+		records = append(records, record)
+	}
+
+	samples, err := fp.processDocument(records, api, fetchedAt)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return samples, newest, nil
+}
+
+// sendSamplesAsMetrics sends Prometheus samples as dimensional metrics, using
+// the remaining sample fields (labels and custom attributes) as attributes.
+// onDone, when not nil, runs once the collector's send has finished.
+func (fp *FileProcessor) sendSamplesAsMetrics(samples []map[string]interface{}, onDone func(delivered bool)) {
+	batch := make([]metrics.Metric, 0, len(samples))
+	for _, sample := range samples {
+		name, _ := sample["metric.name"].(string)
+		value, ok := sample["metric.value"].(float64)
+		if name == "" || !ok {
+			continue
+		}
+
+		attributes := make(map[string]interface{}, len(sample))
+		for k, v := range sample {
+			switch k {
+			case "metric.name", "metric.value", "metric.help", "metric.timestamp":
+				continue
+			case "metric.type":
+				attributes["prometheus.type"] = v
+			default:
+				attributes[k] = v
+			}
+		}
+
+		// Cumulative Prometheus counters are reported as gauges; New Relic
+		// count metrics expect per-interval deltas
+		batch = append(batch, metrics.Metric{Name: name, Type: "gauge", Value: value, Attributes: attributes})
+	}
+	fp.metricsCollector.AddMetrics(batch, onDone)
+}
+
+// parsePrometheusText parses the Prometheus text exposition format, including
+// HELP and TYPE metadata
+func parsePrometheusText(data []byte) ([]promSeries, error) {
+	types := make(map[string]string)
+	helps := make(map[string]string)
+	var series []promSeries
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(strings.TrimPrefix(line, "#"))
+			if len(fields) < 3 {
+				continue
+			}
+			switch fields[0] {
+			case "TYPE":
+				types[fields[1]] = strings.ToLower(fields[2])
+			case "HELP":
+				rest := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+				rest = strings.TrimSpace(strings.TrimPrefix(rest, "HELP"))
+				rest = strings.TrimSpace(strings.TrimPrefix(rest, fields[1]))
+				helps[fields[1]] = unescapePrometheus(rest)
+			}
+			continue
+		}
+
+		s, err := parsePrometheusSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		family := prometheusFamily(s.Name, types)
+		s.Type = types[family]
+		if s.Type == "" {
+			s.Type = "untyped"
+		}
+		s.Help = helps[family]
+		series = append(series, s)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return series, nil
+}
+
+// prometheusFamily maps histogram and summary series back to their metric family
+func prometheusFamily(name string, types map[string]string) string {
+	if _, ok := types[name]; ok {
+		return name
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count", "_created"} {
+		if base := strings.TrimSuffix(name, suffix); base != name {
+			if _, ok := types[base]; ok {
+				return base
+			}
+		}
+	}
+	return name
+}
+
+// parsePrometheusSample parses a line such as `name{label="value"} 1.5 1700000000000`
+func parsePrometheusSample(line string) (promSeries, error) {
+	s := promSeries{Labels: make(map[string]string)}
+
+	nameEnd := strings.IndexAny(line, "{ \t")
+	if nameEnd <= 0 {
+		return s, fmt.Errorf("invalid sample %q", line)
+	}
+	s.Name = line[:nameEnd]
+	rest := line[nameEnd:]
+
+	if strings.HasPrefix(rest, "{") {
+		end, err := parsePrometheusLabels(rest, s.Labels)
+		if err != nil {
+			return s, err
+		}
+		rest = rest[end:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return s, fmt.Errorf("invalid sample value in %q", line)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, fmt.Errorf("invalid sample value %q: %w", fields[0], err)
+	}
+	s.Value = value
+
+	if len(fields) == 2 {
+		ms, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return s, fmt.Errorf("invalid sample timestamp %q: %w", fields[1], err)
+		}
+		s.Timestamp = time.UnixMilli(ms)
+	}
+
+	return s, nil
+}
+
+// parsePrometheusLabels parses a `{a="b",c="d"}` label set into labels and
+// returns the offset just past the closing brace
+func parsePrometheusLabels(text string, labels map[string]string) (int, error) {
+	i := 1 // skip '{'
+	for {
+		for i < len(text) && (text[i] == ' ' || text[i] == ',') {
+			i++
+		}
+		if i >= len(text) {
+			return 0, fmt.Errorf("unterminated label set")
+		}
+		if text[i] == '}' {
+			return i + 1, nil
+		}
+
+		eq := strings.IndexByte(text[i:], '=')
+		if eq < 0 {
+			return 0, fmt.Errorf("invalid label set %q", text)
+		}
+		name := strings.TrimSpace(text[i : i+eq])
+		i += eq + 1
+		if i >= len(text) || text[i] != '"' {
+			return 0, fmt.Errorf("label %s value must be quoted", name)
+		}
+		i++
+
+		var value strings.Builder
+		for {
+			if i >= len(text) {
+				return 0, fmt.Errorf("unterminated value for label %s", name)
+			}
+			c := text[i]
+			if c == '"' {
+				i++
+				break
+			}
+			if c == '\\' && i+1 < len(text) {
+				i++
+				switch text[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(text[i])
+				}
+			} else {
+				value.WriteByte(c)
+			}
+			i++
+		}
+		labels[name] = value.String()
+	}
+}
+
+// unescapePrometheus resolves the escapes allowed in HELP text
+func unescapePrometheus(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(s)
+}
@@ -0,0 +1,154 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// counterState is the last observed value of one counter in one series
+type counterState struct {
+	value float64
+	at    time.Time
+}
+
+// applyRates adds <field>.delta and <field>.rate to samples for every
+// configured counter seen in the previous run. A counter lower than before is
+// treated as reset, so its delta is the new value. Rates are per second of the
+// sample's event timestamp when timestamp_field set one, otherwise of fetch
+// time, so a source polled faster than it updates gets no rate for repeats.
+// Only the series seen in this run are kept for the next one.
+func (fp *FileProcessor) applyRates(api config.APIConfig, samples []map[string]interface{}, now time.Time) {
+	if len(api.Rates.Fields) == 0 {
+		return
+	}
+
+	fp.rateMutex.Lock()
+	previous := fp.counters[api.Name]
+	fp.rateMutex.Unlock()
+
+	current := make(map[string]counterState)
+	resets := 0
+	for _, sample := range samples {
+		series, attributes := seriesIdentity(sample, api)
+		at := now
+		if ms, ok := sample["timestamp"].(int64); ok {
+			at = time.UnixMilli(ms)
+		}
+		for _, field := range api.Rates.Fields {
+			value, ok := numericValue(sample[field])
+			if !ok {
+				continue
+			}
+
+			key := series + "\x1f" + field
+			current[key] = counterState{value: value, at: at}
+
+			last, seen := previous[key]
+			elapsed := at.Sub(last.at).Seconds()
+			if !seen || elapsed <= 0 {
+				continue
+			}
+
+			delta := value - last.value
+			if delta < 0 {
+				delta = value
+				resets++
+			}
+			rate := delta / elapsed
+
+			sample[field+".delta"] = delta
+			sample[field+".rate"] = rate
+			if api.Rates.Metrics {
+				fp.metricsCollector.RecordCounterRate(api.Name, field, delta, rate, attributes)
+			}
+		}
+	}
+
+	fp.rateMutex.Lock()
+	fp.counters[api.Name] = current
+	fp.rateMutex.Unlock()
+
+	if resets > 0 {
+		fp.logger.WithFields(logrus.Fields{
+			"api":    api.Name,
+			"resets": resets,
+		}).Debug("Counters reset since the previous run")
+	}
+}
+
+// seriesIdentity returns the key of the series a sample belongs to and the
+// attributes that identify it. Without series_keys it uses the string fields
+// that look like labels: the timestamp field, numbers and timestamps change
+// from run to run and are left out.
+func seriesIdentity(sample map[string]interface{}, api config.APIConfig) (string, map[string]interface{}) {
+	keys := api.Rates.SeriesKeys
+	if len(keys) == 0 {
+		for k, v := range sample {
+			text, ok := v.(string)
+			if !ok || k == api.Timestamp.Field || containsString(api.Rates.Fields, k) || !isLabel(text) {
+				continue
+			}
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+	}
+
+	attributes := make(map[string]interface{}, len(keys))
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		attributes[k] = sample[k]
+		parts[i] = fmt.Sprintf("%s=%v", k, sample[k])
+	}
+	return strings.Join(parts, "\x1f"), attributes
+}
+
+// isLabel reports whether a string value is neither a number nor a timestamp
+func isLabel(text string) bool {
+	text = strings.TrimSpace(text)
+	if _, err := strconv.ParseFloat(text, 64); err == nil {
+		return false
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+		if _, err := time.Parse(layout, text); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// numericValue converts a counter value to float64
+func numericValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// containsString reports whether slice contains s
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
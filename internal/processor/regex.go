@@ -0,0 +1,348 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/transport"
+	"github.com/sirupsen/logrus"
+)
+
+// processRegex parses plain-text log records with named capture groups and
+// runs the resulting records through the regular JQ and conversion pipeline
+func (fp *FileProcessor) processRegex(data []byte, api config.APIConfig, fetchedAt time.Time) ([]map[string]interface{}, error) {
+	pattern, err := regexp.Compile(api.Regex.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	var recordStart *regexp.Regexp
+	if api.Regex.RecordStart != "" {
+		if recordStart, err = regexp.Compile(api.Regex.RecordStart); err != nil {
+			return nil, fmt.Errorf("invalid record_start: %w", err)
+		}
+	}
+
+	names := pattern.SubexpNames()
+	records := make([]interface{}, 0)
+	unmatched := 0
+	for _, text := range splitLogRecords(string(data), recordStart) {
+		match := pattern.FindStringSubmatchIndex(text)
+		if match == nil {
+			unmatched++
+			continue
+		}
+
+		record := make(map[string]interface{})
+		for i, name := range names {
+			// Skip unnamed groups and optional groups that did not participate
+			if name == "" || match[2*i] < 0 {
+				continue
+			}
+
+			raw := text[match[2*i]:match[2*i+1]]
+			typ := api.Regex.Types[name]
+			if typ == "" {
+				typ = "string"
+			}
+
+			value, err := convertValue(raw, typ, api.Regex.TimestampLayout)
+			if err != nil {
+				fp.logger.WithError(err).WithFields(logrus.Fields{
+					"api":   api.Name,
+					"group": name,
+				}).Debug("Regex group does not match type, keeping raw value")
+				value = raw
+			}
+			record[name] = value
+		}
+		records = append(records, record)
+	}
+
+	if unmatched > 0 {
+		fp.logger.WithFields(logrus.Fields{
+			"api":       api.Name,
+			"unmatched": unmatched,
+		}).Debug("Skipped log records that did not match pattern")
+	}
+
+	return fp.processDocument(records, api, fetchedAt)
+}
+
+// splitLogRecords splits text into records. Without a record start pattern
+// every non-empty line is a record; otherwise lines that do not match the
+// start pattern are appended to the preceding record.
+func splitLogRecords(text string, recordStart *regexp.Regexp) []string {
+	var records []string
+	var current strings.Builder
+	inRecord := false
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		if recordStart == nil {
+			if strings.TrimSpace(line) != "" {
+				records = append(records, line)
+			}
+			continue
+		}
+
+		if recordStart.MatchString(line) {
+			if inRecord {
+				records = append(records, current.String())
+			}
+			current.Reset()
+			current.WriteString(line)
+			inRecord = true
+			continue
+		}
+
+		// Continuation lines before the first record start are dropped
+		if inRecord {
+			current.WriteByte('\n')
+			current.WriteString(line)
+		}
+	}
+
+	if inRecord {
+		records = append(records, strings.TrimRight(current.String(), "\n"))
+	}
+
+	return records
+}
+
+// fetchTail retrieves the bytes appended since the last processed offset using
+// an HTTP Range request. Only complete lines are returned, together with the
+// offset to store once they have been processed and the number of attempts.
+// With record_start the last record is held back until the next record start
+// shows it is complete. New bytes over max_body_bytes return a *limitError.
+func (fp *FileProcessor) fetchTail(ctx context.Context, api config.APIConfig) ([]byte, int64, int, error) {
+	offset := fp.tailOffset(api)
+
+	client, err := fp.clientFor(api)
+	if err != nil {
+		return nil, offset, 0, err
+	}
+
+	resp, attempts, err := transport.Do(ctx, client, api.Retry, fp.logger, func() (*http.Request, error) {
+		req, err := newRequest(ctx, api, "text/plain, */*")
+		if err != nil {
+			return nil, err
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, offset, attempts, fmt.Errorf("HTTP request failed after %d attempt(s): %w", attempts, err)
+	}
+	defer resp.Body.Close()
+
+	var data []byte
+	base := offset
+	max := api.Limits.MaxBodyBytes
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if data, err = io.ReadAll(limitReader(resp.Body, max)); err != nil {
+			return nil, offset, attempts, fmt.Errorf("failed to read response body: %w", err)
+		}
+	case http.StatusOK:
+		// The server ignored the Range header; skip what was already processed
+		limit := max
+		if max > 0 {
+			limit += offset
+		}
+		full, err := io.ReadAll(limitReader(resp.Body, limit))
+		if err != nil {
+			return nil, offset, attempts, fmt.Errorf("failed to read response body: %w", err)
+		}
+		if int64(len(full)) < offset {
+			fp.logger.WithField("api", api.Name).Info("Log file shrank, reading from the beginning")
+			base = 0
+		}
+		data = full[base:]
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Nothing new, unless the file was truncated or rotated
+		if size, ok := contentRangeSize(resp.Header.Get("Content-Range")); ok && size < offset {
+			fp.logger.WithField("api", api.Name).Info("Log file shrank, reading from the beginning")
+			// Free the connection and any host concurrency slot before refetching
+			resp.Body.Close()
+			fp.setTailOffset(api, 0)
+			data, next, more, err := fp.fetchTail(ctx, api)
+			return data, next, attempts + more, err
+		}
+		return nil, offset, attempts, nil
+	default:
+		return nil, offset, attempts, fmt.Errorf("HTTP request returned status %d", resp.StatusCode)
+	}
+
+	// max_body_bytes applies to the new bytes; truncating leaves the rest
+	// for the next cycle
+	data, limitErr := limitBytes(data, max, 0, api.Limits.BodyBehavior)
+	if data == nil && limitErr != nil {
+		return nil, offset, attempts, limitErr
+	}
+
+	// Leave a trailing partial line for the next cycle
+	complete := bytes.LastIndexByte(data, '\n') + 1
+
+	// Continuation lines of the last record may still be on their way. A
+	// truncated read must make progress, so a single record is kept then.
+	// Without new lines since the last cycle the record is taken as complete.
+	if api.Regex.RecordStart != "" {
+		recordStart, err := regexp.Compile(api.Regex.RecordStart)
+		if err != nil {
+			return nil, offset, attempts, fmt.Errorf("invalid record_start: %w", err)
+		}
+		open := lastRecordStart(data[:complete], recordStart)
+		if limitErr != nil && open > 0 || limitErr == nil && open >= 0 && fp.holdTailRecord(api.Name, base+int64(complete)) {
+			complete = open
+		}
+	}
+	data = data[:complete]
+
+	fp.logger.WithFields(logrus.Fields{
+		"url":       api.URL,
+		"offset":    base,
+		"data_size": len(data),
+		"status":    resp.StatusCode,
+	}).Debug("Tailed log data")
+
+	return data, base + int64(complete), attempts, limitErr
+}
+
+// lastRecordStart returns the offset of the last line in data that starts a
+// record, or -1 when no line does. data must end with a newline.
+func lastRecordStart(data []byte, recordStart *regexp.Regexp) int {
+	for end := len(data); end > 0; {
+		start := bytes.LastIndexByte(data[:end-1], '\n') + 1
+		if recordStart.Match(bytes.TrimSuffix(data[start:end-1], []byte("\r"))) {
+			return start
+		}
+		end = start
+	}
+	return -1
+}
+
+// cutTailRecords keeps the first max log records of tailed data, so the
+// rest is read again on the next cycle instead of being dropped. It returns
+// the kept bytes and the number of records in data.
+func cutTailRecords(data []byte, max int, api config.APIConfig) ([]byte, int, error) {
+	var recordStart *regexp.Regexp
+	if api.Regex.RecordStart != "" {
+		var err error
+		if recordStart, err = regexp.Compile(api.Regex.RecordStart); err != nil {
+			return nil, 0, fmt.Errorf("invalid record_start: %w", err)
+		}
+	}
+
+	keep, records := len(data), 0
+	for start := 0; start < len(data); {
+		end := bytes.IndexByte(data[start:], '\n') + start + 1
+		if end == start {
+			end = len(data)
+		}
+		line := bytes.TrimSuffix(bytes.TrimSuffix(data[start:end], []byte("\n")), []byte("\r"))
+
+		// Same record boundaries as splitLogRecords
+		begins := len(bytes.TrimSpace(line)) > 0
+		if recordStart != nil {
+			begins = recordStart.Match(line)
+		}
+		if begins {
+			records++
+			if records == max+1 {
+				keep = start
+			}
+		}
+		start = end
+	}
+	return data[:keep], records, nil
+}
+
+// contentRangeSize extracts the complete length from a "bytes */1234" header
+func contentRangeSize(header string) (int64, bool) {
+	idx := strings.LastIndexByte(header, '/')
+	if idx < 0 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(header[idx+1:], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+// tailState is the persisted position of a tailed log
+type tailState struct {
+	Offset int64 `json:"offset"`
+}
+
+// tailStatePath returns where an API's tail offset is saved, or "" when it
+// is only kept in memory
+func tailStatePath(api config.APIConfig) string {
+	if api.Regex.StateDir == "" {
+		return ""
+	}
+	return filepath.Join(api.Regex.StateDir, "tail", unsafeFileChars.ReplaceAllString(api.Name, "_")+".json")
+}
+
+// tailOffset returns the stored byte offset for an API in tail mode, loading
+// the saved offset on first use
+func (fp *FileProcessor) tailOffset(api config.APIConfig) int64 {
+	fp.tailMutex.Lock()
+	defer fp.tailMutex.Unlock()
+
+	if offset, ok := fp.tailOffsets[api.Name]; ok {
+		return offset
+	}
+
+	var state tailState
+	if path := tailStatePath(api); path != "" {
+		if err := readStateFile(path, &state); err != nil {
+			fp.logger.WithError(err).WithField("api", api.Name).Warn("Failed to load tail offset, reading from the beginning")
+		}
+	}
+	fp.tailOffsets[api.Name] = state.Offset
+	return state.Offset
+}
+
+// setTailOffset stores the byte offset processed so far for an API and saves
+// it so a restart resumes from there
+func (fp *FileProcessor) setTailOffset(api config.APIConfig, offset int64) {
+	fp.tailMutex.Lock()
+	defer fp.tailMutex.Unlock()
+
+	fp.tailOffsets[api.Name] = offset
+	if path := tailStatePath(api); path != "" {
+		if err := writeStateFile(path, tailState{Offset: offset}); err != nil {
+			fp.logger.WithError(err).WithField("api", api.Name).Error("Failed to save tail offset")
+		}
+	}
+}
+
+// holdTailRecord reports whether the open last record of a tailed log, whose
+// complete lines end at end, should be held back for another cycle. It is
+// released once a cycle passes without new complete lines, so the last
+// record of a log that has gone quiet is still sent.
+func (fp *FileProcessor) holdTailRecord(apiName string, end int64) bool {
+	fp.tailMutex.Lock()
+	defer fp.tailMutex.Unlock()
+
+	if held, ok := fp.tailHeld[apiName]; ok && held == end {
+		delete(fp.tailHeld, apiName)
+		return false
+	}
+	fp.tailHeld[apiName] = end
+	return true
+}
@@ -0,0 +1,69 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+)
+
+// newRequest builds the HTTP request for an API from its request settings.
+// The default User-Agent and Accept headers can be overridden per API, and the
+// request is bound to ctx.
+func newRequest(ctx context.Context, api config.APIConfig, accept string) (*http.Request, error) {
+	target, err := api.Request.ResolveURL(api.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	switch {
+	case api.Request.BodyFile != "":
+		// Read on every request so edits to the file apply without a restart
+		content, err := os.ReadFile(api.Request.BodyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body_file: %w", err)
+		}
+		body = strings.NewReader(string(content))
+	case api.Request.Body != "":
+		body = strings.NewReader(api.Request.Body)
+	}
+
+	method := strings.ToUpper(api.Request.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", "Enhanced-Flex-Monitor/1.0")
+	req.Header.Set("Accept", accept)
+	for name, value := range api.Request.ResolveHeaders() {
+		req.Header.Set(name, value)
+	}
+
+	return req, nil
+}
+
+// clientFor returns the shared HTTP client for an API, applying its request
+// timeout or the processor default
+func (fp *FileProcessor) clientFor(api config.APIConfig) (*http.Client, error) {
+	shared, err := fp.transports.Client(api)
+	if err != nil {
+		return nil, err
+	}
+
+	client := *shared
+	client.Timeout = fp.client.Timeout
+	if api.Request.Timeout > 0 {
+		client.Timeout = api.Request.Timeout
+	}
+	return &client, nil
+}
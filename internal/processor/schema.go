@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// validationErrorsKey holds the schema violations of an invalid sample
+const validationErrorsKey = "validation.errors"
+
+// unsafeFileChars matches characters not allowed in quarantine file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// schemaFor returns the compiled schema for an API, compiling it on first use
+func (fp *FileProcessor) schemaFor(api config.APIConfig) (*jsonschema.Schema, error) {
+	fp.schemaMutex.Lock()
+	defer fp.schemaMutex.Unlock()
+
+	if schema, ok := fp.schemas[api.Schema.File]; ok {
+		return schema, nil
+	}
+
+	schema, err := jsonschema.Compile(api.Schema.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema %s: %w", api.Schema.File, err)
+	}
+	fp.schemas[api.Schema.File] = schema
+	return schema, nil
+}
+
+// validateRecord checks a record against the API's schema and returns its
+// violations, or "" when it is valid or the API has no schema
+func (fp *FileProcessor) validateRecord(fields map[string]interface{}, api config.APIConfig) string {
+	if api.Schema.File == "" {
+		return ""
+	}
+
+	// ProcessAPI compiles the schema before any record is processed
+	schema, err := fp.schemaFor(api)
+	if err != nil {
+		return err.Error()
+	}
+
+	err = schema.Validate(fields)
+	if err == nil {
+		return ""
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err.Error()
+	}
+	return strings.Join(violations(validationErr), "; ")
+}
+
+// violations flattens a validation error into its leaf messages
+func violations(err *jsonschema.ValidationError) []string {
+	if len(err.Causes) == 0 {
+		location := err.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		return []string{fmt.Sprintf("%s: %s", location, err.Message)}
+	}
+
+	var messages []string
+	for _, cause := range err.Causes {
+		messages = append(messages, violations(cause)...)
+	}
+	return messages
+}
+
+// applySchema counts valid and invalid samples and handles the invalid ones
+// according to the API's mode: tag keeps them with their violations, drop
+// discards them and quarantine writes them to a JSONL file first
+func (fp *FileProcessor) applySchema(api config.APIConfig, samples []map[string]interface{}, result *ProcessResult) []map[string]interface{} {
+	if api.Schema.File == "" {
+		return samples
+	}
+
+	valid := make([]map[string]interface{}, 0, len(samples))
+	var invalid []map[string]interface{}
+	for _, sample := range samples {
+		if _, ok := sample[validationErrorsKey]; ok {
+			invalid = append(invalid, sample)
+		} else {
+			valid = append(valid, sample)
+		}
+	}
+
+	result.InvalidRecords = len(invalid)
+	fp.metricsCollector.RecordValidation(api.Name, len(valid), len(invalid))
+	if len(invalid) == 0 {
+		return samples
+	}
+
+	fp.logger.WithFields(logrus.Fields{
+		"api":     api.Name,
+		"invalid": len(invalid),
+		"mode":    api.Schema.Invalid,
+	}).Warn("Records failed schema validation")
+
+	switch api.Schema.Invalid {
+	case "tag":
+		return samples
+	case "quarantine":
+		if err := fp.quarantine(api, invalid); err != nil {
+			fp.logger.WithError(err).WithField("api", api.Name).Error("Failed to quarantine invalid records")
+		}
+	}
+	return valid
+}
+
+// quarantine appends invalid samples to the API's JSONL quarantine file
+func (fp *FileProcessor) quarantine(api config.APIConfig, samples []map[string]interface{}) error {
+	if err := os.MkdirAll(api.Schema.QuarantineDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+
+	path := filepath.Join(api.Schema.QuarantineDir, unsafeFileChars.ReplaceAllString(api.Name, "_")+".jsonl")
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open quarantine file: %w", err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, sample := range samples {
+		if err := encoder.Encode(sample); err != nil {
+			return fmt.Errorf("failed to write quarantine file: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// applyTimestamps sets each sample's event timestamp from the API's timestamp
+// field. Samples outside New Relic's accepted window are dropped, since they
+// would be rejected on ingest; samples whose field is missing or unparseable
+// keep the ingestion time.
+func (fp *FileProcessor) applyTimestamps(api config.APIConfig, samples []map[string]interface{}, result *ProcessResult, now time.Time) []map[string]interface{} {
+	opts := api.Timestamp
+	if opts.Field == "" {
+		return samples
+	}
+
+	// Validated at config load
+	location, err := time.LoadLocation(opts.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	kept := make([]map[string]interface{}, 0, len(samples))
+	unparsed := 0
+	for _, sample := range samples {
+		value, ok := sample[opts.Field]
+		if !ok {
+			unparsed++
+			kept = append(kept, sample)
+			continue
+		}
+
+		ts, err := parseEventTime(value, opts, location)
+		if err != nil {
+			unparsed++
+			fp.logger.WithError(err).WithField("api", api.Name).Debug("Failed to parse timestamp field, using ingestion time")
+			kept = append(kept, sample)
+			continue
+		}
+
+		if now.Sub(ts) > config.MaxTimestampAge || ts.Sub(now) > config.MaxTimestampSkew {
+			result.RejectedTimestamps++
+			continue
+		}
+		sample["timestamp"] = ts.UnixMilli()
+		kept = append(kept, sample)
+	}
+
+	fp.metricsCollector.RecordRejectedTimestamps(api.Name, result.RejectedTimestamps)
+	if result.RejectedTimestamps > 0 || unparsed > 0 {
+		fp.logger.WithFields(logrus.Fields{
+			"api":      api.Name,
+			"field":    opts.Field,
+			"rejected": result.RejectedTimestamps,
+			"unparsed": unparsed,
+		}).Warn("Records with unusable timestamps")
+	}
+	return kept
+}
+
+// parseEventTime converts a timestamp field value. Strings are parsed with
+// the layout when one is set; otherwise values are epoch numbers in the
+// configured unit.
+func parseEventTime(value interface{}, opts config.TimestampConfig, location *time.Location) (time.Time, error) {
+	switch v := value.(type) {
+	case string:
+		text := strings.TrimSpace(v)
+		if opts.Layout != "" {
+			return time.ParseInLocation(opts.Layout, text, location)
+		}
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return epochTime(n, opts.Unit), nil
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%q is not an epoch %s value", v, opts.Unit)
+		}
+		return epochFloatTime(f, opts.Unit), nil
+	case int64:
+		return epochTime(v, opts.Unit), nil
+	case int:
+		return epochTime(int64(v), opts.Unit), nil
+	case float64:
+		return epochFloatTime(v, opts.Unit), nil
+	default:
+		return time.Time{}, fmt.Errorf("unsupported timestamp type %T", value)
+	}
+}
+
+// epochTime converts an integer epoch value in unit
+func epochTime(n int64, unit string) time.Time {
+	switch unit {
+	case "ms":
+		return time.UnixMilli(n)
+	case "ns":
+		return time.Unix(0, n)
+	default:
+		return time.Unix(n, 0)
+	}
+}
+
+// epochFloatTime converts a fractional epoch value in unit
+func epochFloatTime(f float64, unit string) time.Time {
+	switch unit {
+	case "ms":
+		return time.Unix(0, int64(f*float64(time.Millisecond)))
+	case "ns":
+		return time.Unix(0, int64(f))
+	default:
+		return time.Unix(0, int64(f*float64(time.Second)))
+	}
+}
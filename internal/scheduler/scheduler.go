@@ -0,0 +1,166 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// schedule computes the next run time after a given time
+type schedule interface {
+	Next(time.Time) time.Time
+}
+
+// intervalSchedule runs at a fixed interval
+type intervalSchedule struct {
+	every time.Duration
+}
+
+// Next implements schedule
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.every)
+}
+
+// job is a schedule and the function it runs. Each job runs in its own
+// goroutine, so runs of the same job never overlap.
+type job struct {
+	name     string
+	schedule schedule
+	splay    time.Duration
+	delay    time.Duration
+	run      func(ctx context.Context)
+}
+
+// Scheduler runs jobs on per-job intervals or cron schedules
+type Scheduler struct {
+	jobs   []*job
+	logger *logrus.Logger
+	wg     sync.WaitGroup
+}
+
+// New creates an empty scheduler
+func New(logger *logrus.Logger) *Scheduler {
+	return &Scheduler{logger: logger}
+}
+
+// Key returns a name identifying a schedule; APIs with the same key can share a job
+func Key(cfg config.ScheduleConfig) string {
+	key := fmt.Sprintf("every %s", cfg.Interval)
+	if cfg.Cron != "" {
+		key = fmt.Sprintf("cron %s", cfg.Cron)
+	}
+	if cfg.Splay > 0 {
+		key += fmt.Sprintf(" splay %s", cfg.Splay)
+	}
+	if cfg.InitialDelay > 0 {
+		key += fmt.Sprintf(" delay %s", cfg.InitialDelay)
+	}
+	return key
+}
+
+// Add registers a job. Interval jobs run first after the initial delay; cron
+// jobs run first at the next matching time after it.
+func (s *Scheduler) Add(name string, cfg config.ScheduleConfig, run func(ctx context.Context)) error {
+	var sched schedule = intervalSchedule{every: cfg.Interval}
+	if cfg.Cron != "" {
+		parsed, err := cron.ParseStandard(cfg.Cron)
+		if err != nil {
+			return fmt.Errorf("invalid cron expression %q: %w", cfg.Cron, err)
+		}
+		sched = parsed
+	} else if cfg.Interval <= 0 {
+		return fmt.Errorf("schedule %s has no interval or cron expression", name)
+	}
+
+	s.jobs = append(s.jobs, &job{
+		name:     name,
+		schedule: sched,
+		splay:    cfg.Splay,
+		delay:    cfg.InitialDelay,
+		run:      run,
+	})
+	return nil
+}
+
+// Start launches every job. Jobs stop when ctx is cancelled; use Wait to
+// block until in-flight runs have finished.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go func(j *job) {
+			defer s.wg.Done()
+			s.loop(ctx, j)
+		}(j)
+	}
+}
+
+// Wait blocks until all jobs have stopped
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// loop runs a job until ctx is cancelled
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	next := time.Now().Add(j.delay)
+	if _, ok := j.schedule.(intervalSchedule); !ok {
+		next = j.schedule.Next(next)
+	}
+
+	for {
+		wait := time.Until(next)
+		if j.splay > 0 {
+			wait += time.Duration(rand.Int63n(int64(j.splay)))
+		}
+
+		s.logger.WithFields(logrus.Fields{
+			"schedule": j.name,
+			"next_run": time.Now().Add(wait),
+		}).Debug("Scheduled next run")
+
+		if !sleep(ctx, wait) {
+			return
+		}
+
+		started := time.Now()
+		j.run(ctx)
+
+		// A run that outlasts its slot skips the missed runs instead of
+		// starting them back to back
+		next = j.schedule.Next(next)
+		missed := 0
+		for !next.After(time.Now()) {
+			next = j.schedule.Next(next)
+			missed++
+		}
+		if missed > 0 {
+			s.logger.WithFields(logrus.Fields{
+				"schedule": j.name,
+				"duration": time.Since(started),
+				"missed":   missed,
+			}).Warn("Run took longer than its schedule, skipping missed runs")
+		}
+	}
+}
+
+// sleep waits for d or until ctx is cancelled, reporting whether it completed
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,124 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSchedulerRunsIntervalsWithoutOverlap(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel) // Suppress logs during tests
+
+	var runs, running, overlaps int32
+	var mu sync.Mutex
+	var starts []time.Time
+
+	s := New(logger)
+	err := s.Add("fast", config.ScheduleConfig{Interval: 20 * time.Millisecond, InitialDelay: 30 * time.Millisecond}, func(ctx context.Context) {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		mu.Lock()
+		starts = append(starts, time.Now())
+		mu.Unlock()
+
+		// Every other run outlasts the interval
+		if atomic.AddInt32(&runs, 1)%2 == 1 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		atomic.AddInt32(&running, -1)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	begin := time.Now()
+	s.Start(ctx)
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	s.Wait()
+
+	if overlaps != 0 {
+		t.Errorf("Expected no overlapping runs, got %d", overlaps)
+	}
+	if runs < 3 {
+		t.Errorf("Expected several runs, got %d", runs)
+	}
+	if len(starts) > 0 && starts[0].Sub(begin) < 30*time.Millisecond {
+		t.Errorf("Expected first run after the initial delay, started after %v", starts[0].Sub(begin))
+	}
+
+	// No runs start after cancellation
+	after := atomic.LoadInt32(&runs)
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != after {
+		t.Error("Expected no runs after the context was cancelled")
+	}
+}
+
+func TestSchedulerSplay(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	started := make(chan time.Time, 1)
+	s := New(logger)
+	s.Add("splayed", config.ScheduleConfig{Interval: time.Hour, Splay: 40 * time.Millisecond}, func(ctx context.Context) {
+		started <- time.Now()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	begin := time.Now()
+	s.Start(ctx)
+
+	select {
+	case at := <-started:
+		if at.Sub(begin) > 40*time.Millisecond+20*time.Millisecond {
+			t.Errorf("Expected first run within the splay, started after %v", at.Sub(begin))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected splayed job to run")
+	}
+}
+
+func TestSchedulerAdd(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	s := New(logger)
+	noop := func(ctx context.Context) {}
+
+	if err := s.Add("cron", config.ScheduleConfig{Cron: "*/5 * * * *"}, noop); err != nil {
+		t.Errorf("Unexpected error for valid cron: %v", err)
+	}
+	if err := s.Add("bad-cron", config.ScheduleConfig{Cron: "every tuesday"}, noop); err == nil {
+		t.Error("Expected error for invalid cron expression")
+	}
+	if err := s.Add("empty", config.ScheduleConfig{}, noop); err == nil {
+		t.Error("Expected error for schedule without interval or cron")
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		schedule config.ScheduleConfig
+		expected string
+	}{
+		{config.ScheduleConfig{Interval: 30 * time.Second}, "every 30s"},
+		{config.ScheduleConfig{Cron: "@hourly", Splay: time.Minute}, "cron @hourly splay 1m0s"},
+		{config.ScheduleConfig{Interval: time.Minute, InitialDelay: 5 * time.Second}, "every 1m0s delay 5s"},
+	}
+
+	for _, tt := range tests {
+		if got := Key(tt.schedule); got != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, got)
+		}
+	}
+}
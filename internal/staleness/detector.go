@@ -1,12 +1,15 @@
 package staleness
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/transport"
 	"github.com/sirupsen/logrus"
 )
 
@@ -36,10 +39,22 @@ type Result struct {
 	ShouldSkip   bool
 	ShouldAlert  bool
 	Error        error
+	Attempts     int
 }
 
 // CheckStaleness checks if a file is stale based on its last modification time
-func (d *Detector) CheckStaleness(urlStr string, threshold time.Duration, behavior string) *Result {
+func (d *Detector) CheckStaleness(ctx context.Context, urlStr string, threshold time.Duration, behavior string) *Result {
+	return d.Check(ctx, StalenessCheck{
+		URL:       urlStr,
+		Threshold: threshold,
+		Behavior:  behavior,
+	})
+}
+
+// Check runs a staleness check, sending the check's headers and applying its
+// timeout to the HEAD request. The request is abandoned when ctx is done.
+func (d *Detector) Check(ctx context.Context, check StalenessCheck) *Result {
+	urlStr, threshold, behavior := check.URL, check.Threshold, check.Behavior
 	result := &Result{
 		Threshold: threshold,
 		Behavior:  behavior,
@@ -53,20 +68,35 @@ func (d *Detector) CheckStaleness(urlStr string, threshold time.Duration, behavi
 	}
 
 	// Get the last modified time from HTTP headers
-	lastModified, err := d.getLastModified(urlStr)
+	lastModified, attempts, err := d.getLastModified(ctx, check)
 	if err != nil {
 		result.Error = fmt.Errorf("failed to get last modified time: %w", err)
+		result.Attempts = attempts
 		d.logger.WithError(err).WithField("url", urlStr).Error("Failed to check file staleness")
 		return result
 	}
 
+	result = d.Evaluate(urlStr, lastModified, threshold, behavior)
+	result.Attempts = attempts
+	return result
+}
+
+// Evaluate applies the staleness threshold and behavior to a known modification
+// time. It is used directly when freshness comes from the payload itself rather
+// than from Last-Modified headers; source only labels log entries.
+func (d *Detector) Evaluate(source string, lastModified time.Time, threshold time.Duration, behavior string) *Result {
+	result := &Result{
+		Threshold: threshold,
+		Behavior:  behavior,
+	}
+
 	result.LastModified = lastModified
 	result.FileAge = time.Since(lastModified)
 	result.IsStale = result.FileAge > threshold
 
 	if result.IsStale {
 		d.logger.WithFields(logrus.Fields{
-			"url":           urlStr,
+			"url":           source,
 			"file_age":      result.FileAge,
 			"threshold":     threshold,
 			"last_modified": lastModified,
@@ -76,16 +106,16 @@ func (d *Detector) CheckStaleness(urlStr string, threshold time.Duration, behavi
 		switch behavior {
 		case "skip":
 			result.ShouldSkip = true
-			d.logger.WithField("url", urlStr).Info("Skipping stale file processing")
+			d.logger.WithField("url", source).Info("Skipping stale file processing")
 		case "alert":
 			result.ShouldAlert = true
-			d.logger.WithField("url", urlStr).Info("Will generate alert for stale file")
+			d.logger.WithField("url", source).Info("Will generate alert for stale file")
 		case "continue":
-			d.logger.WithField("url", urlStr).Info("Continuing to process stale file")
+			d.logger.WithField("url", source).Info("Continuing to process stale file")
 		}
 	} else {
 		d.logger.WithFields(logrus.Fields{
-			"url":           urlStr,
+			"url":           source,
 			"file_age":      result.FileAge,
 			"threshold":     threshold,
 			"last_modified": lastModified,
@@ -95,17 +125,33 @@ func (d *Detector) CheckStaleness(urlStr string, threshold time.Duration, behavi
 	return result
 }
 
-// getLastModified retrieves the last modified time of a file via HTTP HEAD request
-func (d *Detector) getLastModified(url string) (time.Time, error) {
-	req, err := http.NewRequest("HEAD", url, nil)
-	if err != nil {
-		return time.Time{}, fmt.Errorf("failed to create HEAD request: %w", err)
+// getLastModified retrieves the last modified time of a file via HTTP HEAD
+// request, retrying transient failures. It also returns the attempt count.
+func (d *Detector) getLastModified(ctx context.Context, check StalenessCheck) (time.Time, int, error) {
+	url := check.URL
+
+	client := *d.client
+	if check.Client != nil {
+		client = *check.Client
+		client.Timeout = d.client.Timeout
+	}
+	if check.Timeout > 0 {
+		client.Timeout = check.Timeout
 	}
 
 	start := time.Now()
-	resp, err := d.client.Do(req)
+	resp, attempts, err := transport.Do(ctx, &client, check.Retry, d.logger, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create HEAD request: %w", err)
+		}
+		for name, value := range check.Headers {
+			req.Header.Set(name, value)
+		}
+		return req, nil
+	})
 	if err != nil {
-		return time.Time{}, fmt.Errorf("failed to execute HEAD request: %w", err)
+		return time.Time{}, attempts, fmt.Errorf("failed to execute HEAD request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -114,10 +160,11 @@ func (d *Detector) getLastModified(url string) (time.Time, error) {
 		"url":      url,
 		"duration": duration,
 		"status":   resp.StatusCode,
+		"attempts": attempts,
 	}).Debug("HEAD request completed")
 
 	if resp.StatusCode != http.StatusOK {
-		return time.Time{}, fmt.Errorf("HTTP request failed with status %d", resp.StatusCode)
+		return time.Time{}, attempts, fmt.Errorf("HTTP request failed with status %d", resp.StatusCode)
 	}
 
 	// Try to parse Last-Modified header
@@ -125,7 +172,7 @@ func (d *Detector) getLastModified(url string) (time.Time, error) {
 	if lastModifiedStr == "" {
 		// Fallback to current time if Last-Modified header is not present
 		d.logger.WithField("url", url).Warn("Last-Modified header not found, using current time")
-		return time.Now(), nil
+		return time.Now(), attempts, nil
 	}
 
 	// Parse the Last-Modified header (RFC 1123 format)
@@ -148,22 +195,22 @@ func (d *Detector) getLastModified(url string) (time.Time, error) {
 		}
 
 		if err != nil {
-			return time.Time{}, fmt.Errorf("failed to parse Last-Modified header '%s': %w", lastModifiedStr, err)
+			return time.Time{}, attempts, fmt.Errorf("failed to parse Last-Modified header '%s': %w", lastModifiedStr, err)
 		}
 	}
 
-	return lastModified, nil
+	return lastModified, attempts, nil
 }
 
 // CheckMultiple checks staleness for multiple URLs concurrently
-func (d *Detector) CheckMultiple(checks []StalenessCheck) []Result {
+func (d *Detector) CheckMultiple(ctx context.Context, checks []StalenessCheck) []Result {
 	results := make([]Result, len(checks))
 	resultChan := make(chan indexedResult, len(checks))
 
 	// Start concurrent checks
 	for i, check := range checks {
 		go func(index int, c StalenessCheck) {
-			result := d.CheckStaleness(c.URL, c.Threshold, c.Behavior)
+			result := d.Check(ctx, c)
 			resultChan <- indexedResult{Index: index, Result: *result}
 		}(i, check)
 	}
@@ -182,6 +229,36 @@ type StalenessCheck struct {
 	URL       string
 	Threshold time.Duration
 	Behavior  string
+	Headers   map[string]string
+	Timeout   time.Duration
+	Client    *http.Client // per-API client with authentication; nil uses the detector's
+	Retry     config.RetryConfig
+}
+
+// NewCheck builds the staleness check for an API. When use_request is set the
+// probe sends the API's request headers and query parameters and uses its
+// timeout; the probe itself is always a HEAD request.
+func NewCheck(api config.APIConfig) StalenessCheck {
+	check := StalenessCheck{
+		URL:       api.Staleness.CheckURL,
+		Threshold: api.Staleness.Threshold,
+		Behavior:  api.Staleness.Behavior,
+		Retry:     api.Retry,
+	}
+	if check.URL == "" {
+		check.URL = api.URL
+	}
+
+	if api.Staleness.UseRequest {
+		// An unparsable URL is left as is and reported by validateURL
+		if resolved, err := api.Request.ResolveURL(check.URL); err == nil {
+			check.URL = resolved
+		}
+		check.Headers = api.Request.ResolveHeaders()
+		check.Timeout = api.Request.Timeout
+	}
+
+	return check
 }
 
 // indexedResult is used for concurrent processing
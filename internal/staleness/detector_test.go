@@ -1,11 +1,13 @@
 package staleness
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
 	"github.com/sirupsen/logrus"
 )
 
@@ -29,12 +31,12 @@ func TestStalenessDetector(t *testing.T) {
 	defer server.Close()
 
 	tests := []struct {
-		name           string
-		threshold      time.Duration
-		behavior       string
-		expectedStale  bool
-		expectedSkip   bool
-		expectedAlert  bool
+		name          string
+		threshold     time.Duration
+		behavior      string
+		expectedStale bool
+		expectedSkip  bool
+		expectedAlert bool
 	}{
 		{
 			name:          "fresh file with skip behavior",
@@ -72,7 +74,7 @@ func TestStalenessDetector(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := detector.CheckStaleness(server.URL, tt.threshold, tt.behavior)
+			result := detector.CheckStaleness(context.Background(), server.URL, tt.threshold, tt.behavior)
 
 			if result.Error != nil {
 				t.Fatalf("Unexpected error: %v", result.Error)
@@ -115,7 +117,7 @@ func TestStalenessDetectorErrors(t *testing.T) {
 	detector := NewDetector(logger)
 
 	// Test with invalid URL
-	result := detector.CheckStaleness("invalid-url", 5*time.Minute, "skip")
+	result := detector.CheckStaleness(context.Background(), "invalid-url", 5*time.Minute, "skip")
 	if result.Error == nil {
 		t.Error("Expected error for invalid URL, got none")
 	}
@@ -126,7 +128,7 @@ func TestStalenessDetectorErrors(t *testing.T) {
 	}))
 	defer server.Close()
 
-	result = detector.CheckStaleness(server.URL, 5*time.Minute, "skip")
+	result = detector.CheckStaleness(context.Background(), server.URL, 5*time.Minute, "skip")
 	if result.Error == nil {
 		t.Error("Expected error for 500 status, got none")
 	}
@@ -144,7 +146,7 @@ func TestStalenessDetectorNoLastModified(t *testing.T) {
 	}))
 	defer server.Close()
 
-	result := detector.CheckStaleness(server.URL, 5*time.Minute, "skip")
+	result := detector.CheckStaleness(context.Background(), server.URL, 5*time.Minute, "skip")
 	if result.Error != nil {
 		t.Fatalf("Unexpected error: %v", result.Error)
 	}
@@ -181,7 +183,7 @@ func TestCheckMultiple(t *testing.T) {
 		{URL: server2.URL, Threshold: 5 * time.Minute, Behavior: "alert"},
 	}
 
-	results := detector.CheckMultiple(checks)
+	results := detector.CheckMultiple(context.Background(), checks)
 
 	if len(results) != 2 {
 		t.Fatalf("Expected 2 results, got %d", len(results))
@@ -196,4 +198,53 @@ func TestCheckMultiple(t *testing.T) {
 	if !results[1].IsStale {
 		t.Error("Expected second result to be stale")
 	}
-}
\ No newline at end of file
+}
+
+func TestCheckReusesRequestSettings(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	detector := NewDetector(logger)
+	t.Setenv("PROBE_TOKEN", "secret")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("region") != "eu" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Last-Modified", time.Now().Format(time.RFC1123))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	api := config.APIConfig{
+		Name: "probe",
+		URL:  server.URL,
+		Request: config.RequestConfig{
+			Headers: map[string]string{"Authorization": "Bearer ${PROBE_TOKEN}"},
+			Query:   map[string]string{"region": "eu"},
+		},
+		Staleness: config.StalenessConfig{
+			Threshold: time.Hour,
+			Behavior:  "skip",
+		},
+	}
+
+	result := detector.Check(context.Background(), NewCheck(api))
+	if result.Error == nil {
+		t.Error("Expected error when request settings are not reused")
+	}
+
+	api.Staleness.UseRequest = true
+	result = detector.Check(context.Background(), NewCheck(api))
+	if result.Error != nil {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+	if result.IsStale {
+		t.Error("Expected fresh result")
+	}
+}
@@ -0,0 +1,164 @@
+// Package transform applies declarative field transforms, such as renaming,
+// dropping and redacting fields, to samples and alert metadata.
+package transform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+)
+
+// Pipeline is a compiled list of transform steps. A nil pipeline leaves
+// fields unchanged.
+type Pipeline struct {
+	steps []step
+}
+
+// step is one compiled transform
+type step struct {
+	config.TransformConfig
+	pattern *regexp.Regexp
+}
+
+// New compiles transform steps in order
+func New(specs []config.TransformConfig) (*Pipeline, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	p := &Pipeline{steps: make([]step, 0, len(specs))}
+	for i, spec := range specs {
+		s := step{TransformConfig: spec}
+		if spec.Type == "replace" {
+			pattern, err := spec.Regexp()
+			if err != nil {
+				return nil, fmt.Errorf("transforms[%d]: invalid pattern: %w", i, err)
+			}
+			s.pattern = pattern
+		}
+		p.steps = append(p.steps, s)
+	}
+	return p, nil
+}
+
+// Apply runs the pipeline on fields in place. Values that cannot be cast are
+// left unchanged and reported in the returned error; all steps still run.
+func (p *Pipeline) Apply(fields map[string]interface{}) error {
+	if p == nil {
+		return nil
+	}
+
+	var failed []string
+	for _, s := range p.steps {
+		switch s.Type {
+		case "rename":
+			if value, ok := fields[s.Field]; ok {
+				delete(fields, s.Field)
+				fields[s.To] = value
+			}
+		case "drop":
+			for key := range fields {
+				if matchAny(s.Fields, key) {
+					delete(fields, key)
+				}
+			}
+		case "keep":
+			for key := range fields {
+				if !matchAny(s.Fields, key) {
+					delete(fields, key)
+				}
+			}
+		case "replace":
+			for key, value := range fields {
+				text, ok := value.(string)
+				if ok && (len(s.Fields) == 0 || matchAny(s.Fields, key)) {
+					fields[key] = s.pattern.ReplaceAllString(text, s.Replacement)
+				}
+			}
+		case "hash":
+			for key, value := range fields {
+				if matchAny(s.Fields, key) && value != nil {
+					sum := sha256.Sum256([]byte(s.Salt + fmt.Sprint(value)))
+					fields[key] = hex.EncodeToString(sum[:])
+				}
+			}
+		case "cast":
+			for key, value := range fields {
+				if !matchAny(s.Fields, key) {
+					continue
+				}
+				converted, err := cast(value, s.To)
+				if err != nil {
+					failed = append(failed, fmt.Sprintf("%s: %v", key, err))
+					continue
+				}
+				fields[key] = converted
+			}
+		case "set":
+			fields[s.Field] = s.Value
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to cast %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// matchAny reports whether key matches one of the patterns
+func matchAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// cast converts a value to one of config.CastTypes
+func cast(value interface{}, typ string) (interface{}, error) {
+	if typ == "string" {
+		if f, ok := value.(float64); ok {
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
+		}
+		return fmt.Sprint(value), nil
+	}
+
+	text := strings.TrimSpace(fmt.Sprint(value))
+	switch typ {
+	case "int":
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case float64:
+			return int64(v), nil
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+		return strconv.ParseInt(text, 10, 64)
+	case "float":
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		}
+		return strconv.ParseFloat(text, 64)
+	case "bool":
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+		return strconv.ParseBool(text)
+	default:
+		return nil, fmt.Errorf("unsupported cast type: %s", typ)
+	}
+}
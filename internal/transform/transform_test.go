@@ -0,0 +1,110 @@
+package transform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+)
+
+func TestPipeline(t *testing.T) {
+	sum := sha256.Sum256([]byte("pepper" + "ada@example.com"))
+	hashed := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name     string
+		specs    []config.TransformConfig
+		fields   map[string]interface{}
+		expected map[string]interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "rename",
+			specs:    []config.TransformConfig{{Type: "rename", Field: "msg", To: "message"}},
+			fields:   map[string]interface{}{"msg": "hi"},
+			expected: map[string]interface{}{"message": "hi"},
+		},
+		{
+			name:     "drop with pattern",
+			specs:    []config.TransformConfig{{Type: "drop", Fields: []string{"debug.*"}}},
+			fields:   map[string]interface{}{"debug.trace": "x", "debug.id": 1, "status": "ok"},
+			expected: map[string]interface{}{"status": "ok"},
+		},
+		{
+			name:     "keep",
+			specs:    []config.TransformConfig{{Type: "keep", Fields: []string{"status", "api.*"}}},
+			fields:   map[string]interface{}{"status": "ok", "api.name": "a", "noise": true},
+			expected: map[string]interface{}{"status": "ok", "api.name": "a"},
+		},
+		{
+			name: "replace in all strings",
+			specs: []config.TransformConfig{{
+				Type:        "replace",
+				Pattern:     `token=\w+`,
+				Replacement: "token=REDACTED",
+			}},
+			fields:   map[string]interface{}{"url": "/x?token=abc", "line": "token=def seen", "count": float64(2)},
+			expected: map[string]interface{}{"url": "/x?token=REDACTED", "line": "token=REDACTED seen", "count": float64(2)},
+		},
+		{
+			name:     "hash with salt",
+			specs:    []config.TransformConfig{{Type: "hash", Fields: []string{"email"}, Salt: "pepper"}},
+			fields:   map[string]interface{}{"email": "ada@example.com"},
+			expected: map[string]interface{}{"email": hashed},
+		},
+		{
+			name:     "cast",
+			specs:    []config.TransformConfig{{Type: "cast", Fields: []string{"code", "ok"}, To: "int"}},
+			fields:   map[string]interface{}{"code": "404", "ok": true},
+			expected: map[string]interface{}{"code": int64(404), "ok": int64(1)},
+		},
+		{
+			name:     "failed cast keeps value",
+			specs:    []config.TransformConfig{{Type: "cast", Fields: []string{"code"}, To: "float"}},
+			fields:   map[string]interface{}{"code": "n/a"},
+			expected: map[string]interface{}{"code": "n/a"},
+			wantErr:  true,
+		},
+		{
+			name: "steps run in order",
+			specs: []config.TransformConfig{
+				{Type: "set", Field: "env", Value: "prod"},
+				{Type: "rename", Field: "env", To: "environment"},
+				{Type: "cast", Fields: []string{"latency"}, To: "string"},
+			},
+			fields:   map[string]interface{}{"latency": float64(1.5)},
+			expected: map[string]interface{}{"environment": "prod", "latency": "1.5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline, err := New(tt.specs)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+
+			err = pipeline.Apply(tt.fields)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(tt.fields, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, tt.fields)
+			}
+		})
+	}
+}
+
+func TestNilPipeline(t *testing.T) {
+	pipeline, err := New(nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	fields := map[string]interface{}{"a": 1}
+	if err := pipeline.Apply(fields); err != nil || len(fields) != 1 {
+		t.Errorf("Expected nil pipeline to leave fields unchanged, got %v, %v", fields, err)
+	}
+}
@@ -0,0 +1,187 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// tokenRefreshLeeway is how long before expiry a cached OAuth2 token is renewed
+const tokenRefreshLeeway = 30 * time.Second
+
+// authTransport adds credentials to requests sent for an API. Credentials
+// are only attached for the origins (scheme and host) configured for the
+// API, so they are not forwarded when a redirect or pagination link leads to
+// another host or downgrades to plain HTTP.
+type authTransport struct {
+	base    http.RoundTripper
+	auth    config.AuthConfig
+	origins map[string]bool
+	tokens  *tokenSource
+}
+
+// newAuthTransport wraps base with the API's authentication, or returns base
+// unchanged when no authentication is configured
+func newAuthTransport(base http.RoundTripper, api config.APIConfig, logger *logrus.Logger) http.RoundTripper {
+	switch strings.ToLower(api.Auth.Type) {
+	case "", "none":
+		return base
+	}
+
+	t := &authTransport{base: base, auth: api.Auth, origins: make(map[string]bool)}
+	for _, target := range []string{api.URL, api.Staleness.CheckURL} {
+		if u, err := url.Parse(target); err == nil && u.Host != "" {
+			t.origins[origin(u.Scheme, u.Host)] = true
+		}
+	}
+	if strings.ToLower(api.Auth.Type) == "oauth2" {
+		t.tokens = &tokenSource{
+			client: &http.Client{Transport: base, Timeout: 30 * time.Second},
+			auth:   api.Auth,
+			api:    api.Name,
+			logger: logger,
+		}
+	}
+	return t
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.allowed(req.URL) {
+		return t.base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+
+	switch strings.ToLower(t.auth.Type) {
+	case "basic":
+		req.SetBasicAuth(os.ExpandEnv(t.auth.Username), os.ExpandEnv(t.auth.Password))
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+os.ExpandEnv(t.auth.Token))
+	case "oauth2":
+		token, err := t.tokens.Token(req.Context())
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && t.tokens != nil {
+		// The token may have been revoked early; fetch a new one next time
+		t.tokens.Invalidate()
+	}
+	return resp, err
+}
+
+// allowed reports whether credentials may be sent to u. An upgrade from a
+// configured http origin to https is allowed.
+func (t *authTransport) allowed(u *url.URL) bool {
+	if t.origins[origin(u.Scheme, u.Host)] {
+		return true
+	}
+	return strings.EqualFold(u.Scheme, "https") && t.origins[origin("http", u.Host)]
+}
+
+// origin returns the lower-cased scheme://host of a URL
+func origin(scheme, host string) string {
+	return strings.ToLower(scheme + "://" + host)
+}
+
+// tokenSource fetches OAuth2 client-credentials tokens and caches them until
+// shortly before they expire. Tokens are never logged.
+type tokenSource struct {
+	client *http.Client
+	auth   config.AuthConfig
+	api    string
+	logger *logrus.Logger
+
+	mutex  sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// Token returns a valid access token, fetching a new one when needed. A
+// fetch is bound to ctx, so it stops with the request that needed it.
+func (s *tokenSource) Token(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.token != "" && (s.expiry.IsZero() || time.Now().Add(tokenRefreshLeeway).Before(s.expiry)) {
+		return s.token, nil
+	}
+
+	if err := s.fetch(ctx); err != nil {
+		return "", fmt.Errorf("failed to obtain OAuth2 token: %w", err)
+	}
+	return s.token, nil
+}
+
+// Invalidate drops the cached token
+func (s *tokenSource) Invalidate() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.token = ""
+}
+
+// fetch requests a new token from the token endpoint
+func (s *tokenSource) fetch(ctx context.Context) error {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.auth.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.auth.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.auth.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// Client credentials are form-encoded inside the Basic header (RFC 6749 2.3.1)
+	req.SetBasicAuth(url.QueryEscape(os.ExpandEnv(s.auth.ClientID)), url.QueryEscape(os.ExpandEnv(s.auth.ClientSecret)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// The response body is not included in errors as it may echo credentials
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if body.AccessToken == "" {
+		return fmt.Errorf("token response has no access_token")
+	}
+
+	s.token = body.AccessToken
+	s.expiry = time.Time{}
+	if body.ExpiresIn > 0 {
+		s.expiry = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"api":        s.api,
+		"expires_in": body.ExpiresIn,
+	}).Debug("Obtained OAuth2 token")
+
+	return nil
+}
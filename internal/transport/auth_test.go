@@ -0,0 +1,329 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/metrics"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestStaticAuth(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel) // Suppress logs during tests
+
+	t.Setenv("SOURCE_PASSWORD", "hunter2")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		auth     config.AuthConfig
+		expected string
+	}{
+		{
+			name:     "none",
+			auth:     config.AuthConfig{Type: "none"},
+			expected: "",
+		},
+		{
+			name:     "basic with env password",
+			auth:     config.AuthConfig{Type: "basic", Username: "monitor", Password: "${SOURCE_PASSWORD}"},
+			expected: "Basic bW9uaXRvcjpodW50ZXIy",
+		},
+		{
+			name:     "bearer",
+			auth:     config.AuthConfig{Type: "bearer", Token: "static-token"},
+			expected: "Bearer static-token",
+		},
+	}
+
+	registry := newTestRegistry(logger)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := registry.Client(config.APIConfig{Name: tt.name, URL: server.URL, Auth: tt.auth})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if body := readAll(t, resp); body != tt.expected {
+				t.Errorf("Expected Authorization %q, got %q", tt.expected, body)
+			}
+		})
+	}
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+
+	var issued int32
+	var expiresIn int32 = 3600
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "monitor" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "read metrics" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "bearer", "expires_in": %d}`, n, atomic.LoadInt32(&expiresIn))
+	}))
+	defer tokenServer.Close()
+
+	var revoked int32
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == fmt.Sprintf("Bearer token-%d", atomic.LoadInt32(&revoked)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer source.Close()
+
+	api := config.APIConfig{
+		Name: "oauth",
+		URL:  source.URL,
+		Auth: config.AuthConfig{
+			Type:         "oauth2",
+			TokenURL:     tokenServer.URL,
+			ClientID:     "monitor",
+			ClientSecret: "s3cret",
+			Scopes:       []string{"read", "metrics"},
+		},
+	}
+
+	client, err := newTestRegistry(logger).Client(api)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	get := func() (int, string) {
+		resp, err := client.Get(source.URL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode, readAll(t, resp)
+	}
+
+	// The token is cached across requests
+	for i := 0; i < 3; i++ {
+		if _, auth := get(); auth != "Bearer token-1" {
+			t.Fatalf("Expected cached token-1, got %q", auth)
+		}
+	}
+	if n := atomic.LoadInt32(&issued); n != 1 {
+		t.Errorf("Expected 1 token request, got %d", n)
+	}
+
+	// A rejected token is dropped and replaced on the next request
+	atomic.StoreInt32(&revoked, 1)
+	if status, _ := get(); status != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for revoked token, got %d", status)
+	}
+	if _, auth := get(); auth != "Bearer token-2" {
+		t.Errorf("Expected token-2 after revocation, got %q", auth)
+	}
+
+	// Tokens close to expiry are refreshed before use
+	atomic.StoreInt32(&expiresIn, 5)
+	client.Transport.(*authTransport).tokens.Invalidate()
+	get()
+	if _, auth := get(); auth != "Bearer token-4" {
+		t.Errorf("Expected refreshed token-4, got %q", auth)
+	}
+
+	for _, entry := range hook.AllEntries() {
+		line, _ := entry.String()
+		if strings.Contains(line, "token-") || strings.Contains(line, "s3cret") {
+			t.Errorf("Credential leaked to logs: %s", line)
+		}
+	}
+}
+
+func TestOAuth2TokenEndpointError(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "invalid_client", "client_secret": "wrong"}`))
+	}))
+	defer tokenServer.Close()
+
+	api := config.APIConfig{
+		Name: "oauth",
+		URL:  "http://127.0.0.1:1",
+		Auth: config.AuthConfig{Type: "oauth2", TokenURL: tokenServer.URL, ClientID: "id", ClientSecret: "wrong"},
+	}
+
+	client, _ := newTestRegistry(logger).Client(api)
+	_, err := client.Get(api.URL)
+	if err == nil {
+		t.Fatal("Expected error from token endpoint")
+	}
+	if strings.Contains(err.Error(), "wrong") {
+		t.Errorf("Error exposes token response: %v", err)
+	}
+}
+
+func TestOAuth2TokenFetchCancelled(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	release := make(chan struct{})
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer tokenServer.Close()
+	defer close(release)
+
+	api := config.APIConfig{
+		Name: "oauth",
+		URL:  "http://127.0.0.1:1",
+		Auth: config.AuthConfig{Type: "oauth2", TokenURL: tokenServer.URL, ClientID: "id", ClientSecret: "secret"},
+	}
+	client, _ := newTestRegistry(logger).Client(api)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, api.URL, nil)
+
+	start := time.Now()
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("Expected the token fetch to stop with the request")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the token fetch to honour the request context, took %v", elapsed)
+	}
+}
+
+func TestAuthNotForwardedAcrossHosts(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer other.Close()
+
+	// Same address, different host name
+	target := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+	}))
+	defer source.Close()
+
+	api := config.APIConfig{
+		Name: "redirecting",
+		URL:  source.URL,
+		Auth: config.AuthConfig{Type: "bearer", Token: "s3cret"},
+	}
+	client, err := newTestRegistry(logger).Client(api)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	resp, err := client.Get(api.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the redirect to be followed, got status %d", resp.StatusCode)
+	}
+	if body := readAll(t, resp); body != "" {
+		t.Errorf("Expected no credentials on the other host, got %q", body)
+	}
+}
+
+func readAll(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read body: %v", err)
+	}
+	return string(body)
+}
+
+func TestAuthNotSentOverDowngradedScheme(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	var sent string
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req.Header.Get("Authorization")
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+
+	tests := []struct {
+		name       string
+		configured string
+		target     string
+		expectAuth bool
+	}{
+		{name: "same origin", configured: "https://api.example.com/data", target: "https://api.example.com/next", expectAuth: true},
+		{name: "downgrade to http", configured: "https://api.example.com/data", target: "http://api.example.com/next"},
+		{name: "configured http", configured: "http://api.example.com/data", target: "http://api.example.com/next", expectAuth: true},
+		{name: "upgrade to https", configured: "http://api.example.com/data", target: "https://api.example.com/next", expectAuth: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := config.APIConfig{Name: tt.name, URL: tt.configured, Auth: config.AuthConfig{Type: "bearer", Token: "s3cret"}}
+			transport := newAuthTransport(base, api, logger)
+
+			sent = ""
+			req, _ := http.NewRequest(http.MethodGet, tt.target, nil)
+			if _, err := transport.RoundTrip(req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if (sent != "") != tt.expectAuth {
+				t.Errorf("Expected credentials %v, got %q", tt.expectAuth, sent)
+			}
+		})
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newTestRegistry(logger *logrus.Logger) *Registry {
+	return NewRegistry(logger, metrics.NewCollector(config.NewRelicConfig{}, logger))
+}
@@ -0,0 +1,178 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// hostLimiter bounds the concurrent requests and request rate for one
+// upstream host. It is shared by every API that fetches from the host.
+type hostLimiter struct {
+	slots  chan struct{} // nil when concurrency is unlimited
+	bucket *tokenBucket  // nil when the rate is unlimited
+}
+
+// newHostLimiter creates a limiter, or returns nil when limits has no limits
+func newHostLimiter(limits config.RateLimitConfig) *hostLimiter {
+	if limits.MaxConcurrency <= 0 && limits.RequestsPerSecond <= 0 {
+		return nil
+	}
+
+	l := &hostLimiter{}
+	if limits.MaxConcurrency > 0 {
+		l.slots = make(chan struct{}, limits.MaxConcurrency)
+	}
+	if limits.RequestsPerSecond > 0 {
+		burst := float64(limits.Burst)
+		if burst < 1 {
+			burst = 1
+		}
+		l.bucket = &tokenBucket{
+			rate:   limits.RequestsPerSecond,
+			burst:  burst,
+			tokens: burst,
+			last:   time.Now(),
+		}
+	}
+	return l
+}
+
+// acquire waits for a concurrency slot and a rate token. It returns the time
+// spent waiting; on error nothing is held.
+func (l *hostLimiter) acquire(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return time.Since(start), ctx.Err()
+		}
+	}
+
+	if l.bucket != nil {
+		if delay := l.bucket.reserve(time.Now()); delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				l.bucket.cancel()
+				l.release()
+				return time.Since(start), ctx.Err()
+			}
+		}
+	}
+
+	return time.Since(start), nil
+}
+
+// release frees the concurrency slot taken by acquire
+func (l *hostLimiter) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// tokenBucket is a token bucket refilled at rate tokens per second
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token, going into debt if none is left, and returns how
+// long to wait before the token may be used
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns a reserved token that was not used
+func (b *tokenBucket) cancel() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens++
+}
+
+// limitTransport applies the limits of the request's host before sending it
+type limitTransport struct {
+	base     http.RoundTripper
+	api      string
+	host     string // the API's own host
+	limits   config.RateLimitConfig
+	registry *Registry
+}
+
+// newLimitTransport wraps base with the API's host limits, or returns base
+// unchanged when the API has none
+func newLimitTransport(base http.RoundTripper, api config.APIConfig, registry *Registry) http.RoundTripper {
+	if api.RateLimit.MaxConcurrency <= 0 && api.RateLimit.RequestsPerSecond <= 0 {
+		return base
+	}
+	return &limitTransport{base: base, api: api.Name, host: config.HostOf(api.URL), limits: api.RateLimit, registry: registry}
+}
+
+// RoundTrip implements http.RoundTripper. The concurrency slot is held until
+// the response body is closed, so callers must close a response before
+// sending another request to the same host or they can block on themselves.
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Host)
+	limiter := t.registry.hostLimiter(host, t.limits, host == t.host)
+	if limiter == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	wait, err := limiter.acquire(req.Context())
+	if wait > 0 {
+		t.registry.metrics.RecordLimiterWait(t.api, host, wait)
+		t.registry.logger.WithFields(logrus.Fields{
+			"api":  t.api,
+			"host": host,
+			"wait": wait,
+		}).Debug("Waited for host rate limit")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		limiter.release()
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: limiter.release}
+	return resp, nil
+}
+
+// releaseBody releases a concurrency slot when the body is closed
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Close implements io.Closer
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,174 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHostConcurrencyLimit(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel) // Suppress logs during tests
+
+	var inFlight, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+	}))
+	defer server.Close()
+
+	// Two APIs on the same host share one limiter
+	registry := newTestRegistry(logger)
+	limits := config.RateLimitConfig{MaxConcurrency: 2}
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b"} {
+		client, err := registry.Client(config.APIConfig{Name: name, URL: server.URL, RateLimit: limits})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := client.Get(server.URL)
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+					return
+				}
+				resp.Body.Close()
+			}()
+		}
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("Expected at most 2 concurrent requests to the host, got %d", peak)
+	}
+}
+
+func TestHostRateLimit(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client, _ := newTestRegistry(logger).Client(config.APIConfig{
+		Name:      "limited",
+		URL:       server.URL,
+		RateLimit: config.RateLimitConfig{RequestsPerSecond: 20, Burst: 2},
+	})
+
+	// The burst goes out at once; the next two wait 50ms each
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected requests beyond the burst to be delayed, took %v", elapsed)
+	}
+
+	// Waiting for a token stops when the request is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	client, _ = newTestRegistry(logger).Client(config.APIConfig{
+		Name:      "slow",
+		URL:       server.URL,
+		RateLimit: config.RateLimitConfig{RequestsPerSecond: 0.1, Burst: 1},
+	})
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	req, _ = http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	if _, err := client.Do(req); err == nil {
+		t.Error("Expected cancelled wait to fail")
+	}
+}
+
+func TestForeignHostUsesGlobalLimits(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	own := httptest.NewServer(handler)
+	defer own.Close()
+	named := httptest.NewServer(handler)
+	defer named.Close()
+	foreign := httptest.NewServer(handler)
+	defer foreign.Close()
+
+	fast := config.RateLimitConfig{RequestsPerSecond: 1000, Burst: 10}
+	apis := []config.APIConfig{
+		{Name: "own", URL: own.URL, RateLimit: fast},
+		{Name: "named", URL: named.URL, RateLimit: fast},
+	}
+	registry := newTestRegistry(logger)
+	registry.SetRateLimits(config.RateLimitConfig{RequestsPerSecond: 0.1, Burst: 1}, apis)
+	client, _ := registry.Client(apis[0])
+
+	get := func(url string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// A host another API is configured for keeps that API's limits
+	for i := 0; i < 3; i++ {
+		if err := get(named.URL); err != nil {
+			t.Fatalf("Expected the named host's limits, got %v", err)
+		}
+	}
+
+	// Any other host gets the global limits, not the requesting API's
+	if err := get(foreign.URL); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := get(foreign.URL); err == nil {
+		t.Error("Expected the global rate limit on a host no API names")
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := &tokenBucket{rate: 10, burst: 2, tokens: 2, last: now}
+
+	expected := []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond}
+	for i, want := range expected {
+		if got := b.reserve(now); got != want {
+			t.Errorf("Reservation %d: expected %v, got %v", i+1, want, got)
+		}
+	}
+
+	// Cancelled reservations give their token back
+	b.cancel()
+	b.cancel()
+	if got := b.reserve(now.Add(time.Second)); got != 0 {
+		t.Errorf("Expected a refilled bucket, got wait %v", got)
+	}
+}
@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// Registry builds and caches one HTTP client per API so that the data fetch
+// and the staleness probe share connections, TLS settings and credentials.
+// Host limiters are shared across APIs.
+type Registry struct {
+	clients      map[string]*http.Client
+	mutex        sync.Mutex
+	limiters     map[string]*hostLimiter
+	hostLimits   map[string]config.RateLimitConfig
+	globalLimits config.RateLimitConfig
+	limiterMutex sync.Mutex
+	metrics      *metrics.Collector
+	logger       *logrus.Logger
+}
+
+// NewRegistry creates an empty client registry
+func NewRegistry(logger *logrus.Logger, metricsCollector *metrics.Collector) *Registry {
+	return &Registry{
+		clients:  make(map[string]*http.Client),
+		limiters: make(map[string]*hostLimiter),
+		metrics:  metricsCollector,
+		logger:   logger,
+	}
+}
+
+// Client returns the cached client for an API, building it on first use.
+// The client has no timeout; callers apply their own.
+func (r *Registry) Client(api config.APIConfig) (*http.Client, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if client, ok := r.clients[api.Name]; ok {
+		return client, nil
+	}
+
+	base, err := newBaseTransport(api, r.logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure TLS for %s: %w", api.Name, err)
+	}
+	rt := newAuthTransport(base, api, r.logger)
+	rt = newLimitTransport(rt, api, r)
+
+	client := &http.Client{Transport: rt}
+	r.clients[api.Name] = client
+	return client, nil
+}
+
+// SetRateLimits records the limits of every host an API is configured for,
+// and the global limits used for any other host its requests reach, such as
+// a redirect or pagination target. It must be called before the first request.
+func (r *Registry) SetRateLimits(global config.RateLimitConfig, apis []config.APIConfig) {
+	r.limiterMutex.Lock()
+	defer r.limiterMutex.Unlock()
+
+	r.globalLimits = global
+	r.hostLimits = make(map[string]config.RateLimitConfig, len(apis))
+	for _, api := range apis {
+		host := config.HostOf(api.URL)
+		if _, ok := r.hostLimits[host]; !ok {
+			r.hostLimits[host] = api.RateLimit
+		}
+	}
+}
+
+// hostLimiter returns the limiter for a host, creating it on first use, or
+// nil when the host has no limits. A host an API is configured for uses that
+// API's limits, and configuration validation ensures APIs on a host agree.
+// own is the limits of the API making the request, used for its own host
+// when SetRateLimits was not called.
+func (r *Registry) hostLimiter(host string, own config.RateLimitConfig, ownHost bool) *hostLimiter {
+	r.limiterMutex.Lock()
+	defer r.limiterMutex.Unlock()
+
+	if limiter, ok := r.limiters[host]; ok {
+		return limiter
+	}
+
+	limits, ok := r.hostLimits[host]
+	if !ok {
+		limits = r.globalLimits
+		if ownHost {
+			limits = own
+		}
+	}
+	limiter := newHostLimiter(limits)
+	r.limiters[host] = limiter
+	return limiter
+}
@@ -0,0 +1,172 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// maxDrainBytes is how much of a retried response is read to reuse its connection
+const maxDrainBytes = 64 << 10
+
+// Do sends the request built by newRequest, retrying transient failures
+// according to policy. The request is rebuilt for every attempt so bodies can
+// be resent. Requests that may have changed state on the server (anything but
+// GET, HEAD and OPTIONS) are only retried when the policy opts in. Waiting
+// between attempts stops when ctx is done. It returns the final response or
+// error and the attempt count.
+func Do(ctx context.Context, client *http.Client, policy config.RetryConfig, logger *logrus.Logger, newRequest func() (*http.Request, error)) (*http.Response, int, error) {
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, attempt - 1, err
+		}
+
+		resp, err := client.Do(req)
+		// Cancellation is never retried
+		if attempt >= maxAttempts || ctx.Err() != nil || !policy.NonIdempotent && !idempotent(req.Method) {
+			return resp, attempt, err
+		}
+
+		var delay time.Duration
+		var reason string
+		switch {
+		case err != nil:
+			class := errorClass(err)
+			if class == "" || !containsString(policy.RetryOnErrors, class) {
+				return resp, attempt, err
+			}
+			delay = backoff(policy, attempt)
+			reason = class
+		case containsInt(policy.RetryOnStatus, resp.StatusCode):
+			delay = backoff(policy, attempt)
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+				if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+					delay = policy.MaxBackoff
+				}
+			}
+			reason = strconv.Itoa(resp.StatusCode)
+			// Drain a little so the connection can be reused
+			io.CopyN(io.Discard, resp.Body, maxDrainBytes)
+			resp.Body.Close()
+		default:
+			return resp, attempt, nil
+		}
+
+		logger.WithFields(logrus.Fields{
+			"url":     req.URL.Redacted(),
+			"attempt": attempt,
+			"reason":  reason,
+			"delay":   delay,
+		}).Warn("Request failed, retrying")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, attempt, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// idempotent reports whether a request can be replayed without side effects
+func idempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// backoff returns the exponential delay before the next attempt, capped at
+// the maximum backoff and reduced by up to the jitter fraction
+func backoff(policy config.RetryConfig, attempt int) time.Duration {
+	delay := float64(policy.BaseBackoff) * math.Pow(2, float64(attempt-1))
+	if policy.MaxBackoff > 0 && delay > float64(policy.MaxBackoff) {
+		delay = float64(policy.MaxBackoff)
+	}
+	delay -= delay * policy.Jitter * rand.Float64()
+	return time.Duration(delay)
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		delay := time.Until(at)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// errorClass maps a transport error to a retry class, or "" if it is not
+// transient (for example a TLS verification failure)
+func errorClass(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return "dns"
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		// TLS alerts from the peer will not go away on retry
+		if opErr.Op == "remote error" {
+			return ""
+		}
+		return "connection"
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return "connection"
+	}
+
+	return ""
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+func TestDoRetries(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel) // Suppress logs during tests
+
+	policy := config.RetryConfig{
+		MaxAttempts:   3,
+		BaseBackoff:   time.Millisecond,
+		MaxBackoff:    10 * time.Millisecond,
+		Jitter:        0.2,
+		RetryOnStatus: []int{429, 502, 503},
+		RetryOnErrors: []string{"timeout", "connection"},
+		NonIdempotent: true,
+	}
+
+	tests := []struct {
+		name             string
+		statuses         []int
+		expectedAttempts int
+		expectedStatus   int
+	}{
+		{
+			name:             "success on first attempt",
+			statuses:         []int{200},
+			expectedAttempts: 1,
+			expectedStatus:   200,
+		},
+		{
+			name:             "transient 502 then success",
+			statuses:         []int{502, 502, 200},
+			expectedAttempts: 3,
+			expectedStatus:   200,
+		},
+		{
+			name:             "attempts exhausted",
+			statuses:         []int{503, 503, 503, 200},
+			expectedAttempts: 3,
+			expectedStatus:   503,
+		},
+		{
+			name:             "non-retryable status",
+			statuses:         []int{404, 200},
+			expectedAttempts: 1,
+			expectedStatus:   404,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&calls, 1)
+				// The body must be resent on every attempt
+				if body, _ := io.ReadAll(r.Body); string(body) != "payload" {
+					t.Errorf("Attempt %d sent body %q", n, body)
+				}
+				w.WriteHeader(tt.statuses[n-1])
+			}))
+			defer server.Close()
+
+			resp, attempts, err := Do(context.Background(), server.Client(), policy, logger, func() (*http.Request, error) {
+				return http.NewRequest("POST", server.URL, strings.NewReader("payload"))
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if attempts != tt.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", tt.expectedAttempts, attempts)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestDoRetriesOnlyIdempotentMethods(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	tests := []struct {
+		method           string
+		nonIdempotent    bool
+		expectedAttempts int
+	}{
+		{method: "GET", expectedAttempts: 2},
+		{method: "HEAD", expectedAttempts: 2},
+		{method: "POST", expectedAttempts: 1},
+		{method: "DELETE", expectedAttempts: 1},
+		{method: "POST", nonIdempotent: true, expectedAttempts: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s non_idempotent=%v", tt.method, tt.nonIdempotent), func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					w.WriteHeader(http.StatusBadGateway)
+				}
+			}))
+			defer server.Close()
+
+			policy := config.RetryConfig{MaxAttempts: 3, BaseBackoff: time.Millisecond, RetryOnStatus: []int{502}, NonIdempotent: tt.nonIdempotent}
+			resp, attempts, err := Do(context.Background(), server.Client(), policy, logger, func() (*http.Request, error) {
+				return http.NewRequest(tt.method, server.URL, nil)
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			resp.Body.Close()
+			if attempts != tt.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", tt.expectedAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestDoRetriesConnectionErrors(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closedURL := server.URL
+	server.Close()
+
+	policy := config.RetryConfig{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond, RetryOnErrors: []string{"connection"}}
+	_, attempts, err := Do(context.Background(), http.DefaultClient, policy, logger, func() (*http.Request, error) {
+		return http.NewRequest("GET", closedURL, nil)
+	})
+	if err == nil || attempts != 3 {
+		t.Errorf("Expected 3 failed attempts, got %d (err %v)", attempts, err)
+	}
+
+	policy.RetryOnErrors = nil
+	_, attempts, _ = Do(context.Background(), http.DefaultClient, policy, logger, func() (*http.Request, error) {
+		return http.NewRequest("GET", closedURL, nil)
+	})
+	if attempts != 1 {
+		t.Errorf("Expected no retries when connection errors are not retryable, got %d attempts", attempts)
+	}
+}
+
+func TestDoHonorsRetryAfter(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	newRequest := func() (*http.Request, error) {
+		return http.NewRequest("GET", server.URL, nil)
+	}
+
+	policy := config.RetryConfig{MaxAttempts: 2, BaseBackoff: time.Millisecond, MaxBackoff: 5 * time.Second, RetryOnStatus: []int{429}}
+	start := time.Now()
+	resp, _, err := Do(context.Background(), server.Client(), policy, logger, newRequest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected to wait for Retry-After, waited %v", elapsed)
+	}
+
+	// Retry-After is capped by the maximum backoff
+	atomic.StoreInt32(&calls, 0)
+	policy.MaxBackoff = 20 * time.Millisecond
+	start = time.Now()
+	resp, _, err = Do(context.Background(), server.Client(), policy, logger, newRequest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Expected Retry-After to be capped, waited %v", elapsed)
+	}
+}
+
+func TestDoStopsWhenCancelled(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	// Cancellation interrupts the wait before the next attempt
+	policy := config.RetryConfig{MaxAttempts: 3, BaseBackoff: 5 * time.Second, MaxBackoff: 5 * time.Second, RetryOnStatus: []int{503}}
+	start := time.Now()
+	_, attempts, err := Do(ctx, server.Client(), policy, logger, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	})
+	if err != context.Canceled || attempts != 1 {
+		t.Errorf("Expected cancellation after 1 attempt, got %d attempts (err %v)", attempts, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected backoff to stop on cancellation, waited %v", elapsed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := config.RetryConfig{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for i, want := range expected {
+		if got := backoff(policy, i+1); got != want {
+			t.Errorf("Attempt %d: expected %v, got %v", i+1, want, got)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := backoff(policy, 1); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("Jittered backoff %v outside [50ms, 100ms]", got)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// newBaseTransport returns the transport for an API. APIs without TLS
+// settings share the default transport; others get their own.
+func newBaseTransport(api config.APIConfig, logger *logrus.Logger) (http.RoundTripper, error) {
+	if api.TLS == (config.TLSConfig{}) {
+		return http.DefaultTransport, nil
+	}
+
+	tlsConfig, err := buildTLSConfig(api.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	if api.TLS.Insecure {
+		logger.WithFields(logrus.Fields{
+			"api": api.Name,
+			"url": api.URL,
+		}).Warn("TLS certificate verification is DISABLED for this API; connections can be intercepted. Use tls.ca_file instead of tls.insecure outside of testing")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// buildTLSConfig loads the CA bundle and client certificate for an API
+func buildTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.Insecure,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if cfg.MinVersion != "" {
+		version, ok := config.TLSVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS min_version %s", cfg.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
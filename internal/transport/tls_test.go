@@ -0,0 +1,201 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, clientCert := writeClientCertificate(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	// The httptest certificate is valid for example.com and 127.0.0.1
+	caFile := filepath.Join(dir, "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", server.Certificate().Raw)
+
+	tests := []struct {
+		name        string
+		tls         config.TLSConfig
+		expectError bool
+	}{
+		{
+			name:        "default roots do not trust private CA",
+			tls:         config.TLSConfig{},
+			expectError: true,
+		},
+		{
+			name: "private CA bundle",
+			tls:  config.TLSConfig{CAFile: caFile},
+		},
+		{
+			name: "client certificate",
+			tls:  config.TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3"},
+		},
+		{
+			name: "matching server name",
+			tls:  config.TLSConfig{CAFile: caFile, ServerName: "example.com"},
+		},
+		{
+			name:        "mismatched server name",
+			tls:         config.TLSConfig{CAFile: caFile, ServerName: "other.internal"},
+			expectError: true,
+		},
+		{
+			name: "insecure",
+			tls:  config.TLSConfig{Insecure: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logrus.New()
+			logger.SetLevel(logrus.FatalLevel) // Suppress logs during tests
+
+			client, err := newTestRegistry(logger).Client(config.APIConfig{Name: tt.name, URL: server.URL, TLS: tt.tls})
+			if err != nil {
+				t.Fatalf("Unexpected error building client: %v", err)
+			}
+
+			resp, err := client.Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if tt.expectError && err == nil {
+				t.Error("Expected TLS error but request succeeded")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestTLSRequiresClientCertificate(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	dir := t.TempDir()
+	certFile, keyFile, clientCert := writeClientCertificate(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", server.Certificate().Raw)
+
+	registry := newTestRegistry(logger)
+	withoutCert, _ := registry.Client(config.APIConfig{Name: "no-cert", TLS: config.TLSConfig{CAFile: caFile}})
+	if resp, err := withoutCert.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Error("Expected handshake failure without client certificate")
+	}
+
+	withCert, _ := registry.Client(config.APIConfig{Name: "cert", TLS: config.TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}})
+	resp, err := withCert.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error with client certificate: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestTLSInsecureWarns(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+
+	if _, err := newTestRegistry(logger).Client(config.APIConfig{Name: "lab", TLS: config.TLSConfig{Insecure: true}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != logrus.WarnLevel || entry.Data["api"] != "lab" {
+		t.Errorf("Expected warning for insecure TLS, got %v", entry)
+	}
+}
+
+func TestTLSInvalidFiles(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0644)
+
+	if _, err := newTestRegistry(logger).Client(config.APIConfig{Name: "bad", TLS: config.TLSConfig{CAFile: notPEM}}); err == nil {
+		t.Error("Expected error for CA file without certificates")
+	}
+}
+
+// writeClientCertificate writes a self-signed client certificate and key to dir
+func writeClientCertificate(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "flex-monitor"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+
+	return certFile, keyFile, cert
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
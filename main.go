@@ -16,7 +16,10 @@ import (
 	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/config"
 	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/metrics"
 	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/processor"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/scheduler"
 	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/staleness"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/transform"
+	"github.com/satyampsoni/new-relic-hackathon-o11y/internal/transport"
 	"github.com/sirupsen/logrus"
 )
 
@@ -106,9 +109,15 @@ func initializeApplication() (*Application, error) {
 
 	// Initialize components
 	metricsCollector := metrics.NewCollector(cfg.NewRelic, logger)
-	alertManager := alerts.NewManager(cfg.GetEnabledAlertChannels(), logger)
+	alertTransforms, err := transform.New(cfg.Alerts.Transforms)
+	if err != nil {
+		return nil, fmt.Errorf("invalid alert transforms: %w", err)
+	}
+	alertManager := alerts.NewManager(cfg.GetEnabledAlertChannels(), alertTransforms, logger)
 	stalenessDetector := staleness.NewDetector(logger)
-	fileProcessor := processor.NewFileProcessor(logger, metricsCollector, stalenessDetector)
+	transports := transport.NewRegistry(logger, metricsCollector)
+	transports.SetRateLimits(cfg.Global.RateLimit, cfg.APIs)
+	fileProcessor := processor.NewFileProcessor(logger, metricsCollector, stalenessDetector, transports)
 
 	// Initialize HTTP server for metrics endpoints
 	port := 8080
@@ -118,7 +127,7 @@ func initializeApplication() (*Application, error) {
 			port = 8080
 		}
 	}
-	httpServer := api.NewServer(port, stalenessDetector, alertManager, cfg, logger)
+	httpServer := api.NewServer(port, stalenessDetector, transports, fileProcessor, alertManager, cfg, logger)
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -180,9 +189,6 @@ func (app *Application) setupGracefulShutdown() {
 
 // run starts the main processing loop
 func (app *Application) run() {
-	ticker := time.NewTicker(app.config.Global.Interval)
-	defer ticker.Stop()
-
 	// Start HTTP server for metrics endpoints
 	app.wg.Add(1)
 	go func() {
@@ -201,43 +207,98 @@ func (app *Application) run() {
 		})
 	}
 
-	// Initial processing
-	app.processAPIs()
+	// Group APIs that share a schedule so they run together as one batch
+	sched := scheduler.New(app.logger)
+	groups := make(map[string][]config.APIConfig)
+	var order []string
+	for _, api := range app.config.GetEnabledAPIs() {
+		key := scheduler.Key(api.Schedule)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], api)
+	}
+	if len(order) == 0 {
+		app.logger.Warn("No enabled APIs found")
+	}
+
+	for _, key := range order {
+		name, apis := key, groups[key]
+		if err := sched.Add(name, apis[0].Schedule, func(ctx context.Context) {
+			app.processAPIs(ctx, name, apis)
+		}); err != nil {
+			app.logger.WithError(err).WithField("schedule", name).Error("Failed to schedule APIs")
+			continue
+		}
+		app.logger.WithFields(logrus.Fields{
+			"schedule":  name,
+			"api_count": len(apis),
+		}).Info("Scheduled APIs")
+	}
+	sched.Start(app.ctx)
+
+	// The global interval controls how often metrics and events are flushed
+	ticker := time.NewTicker(app.config.Global.Interval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-app.ctx.Done():
 			app.logger.Info("Shutdown requested, stopping processing")
+			sched.Wait()
 			app.shutdown()
 			return
 		case <-ticker.C:
-			app.processAPIs()
+			if app.config.Global.EnableMetrics {
+				if err := app.metricsCollector.SendBatch(app.ctx); err != nil {
+					app.logger.WithError(err).Error("Failed to send metrics batch")
+				}
+			}
 		}
 	}
 }
 
-// processAPIs processes all configured APIs
-func (app *Application) processAPIs() {
+// processAPIs processes the APIs that share a schedule; in-flight requests
+// are abandoned when ctx is cancelled
+func (app *Application) processAPIs(ctx context.Context, schedule string, enabledAPIs []config.APIConfig) {
 	start := time.Now()
-	enabledAPIs := app.config.GetEnabledAPIs()
 
-	if len(enabledAPIs) == 0 {
-		app.logger.Warn("No enabled APIs found")
-		return
-	}
-
-	app.logger.WithField("api_count", len(enabledAPIs)).Info("Starting API processing cycle")
+	app.logger.WithFields(logrus.Fields{
+		"schedule":  schedule,
+		"api_count": len(enabledAPIs),
+	}).Info("Starting API processing run")
 
 	// Process APIs concurrently
-	results := app.fileProcessor.ProcessAPIs(enabledAPIs, app.config.Global.WorkerCount)
+	results := app.fileProcessor.ProcessAPIs(ctx, enabledAPIs, app.config.Global.WorkerCount)
 
 	// Analyze results and send alerts if needed
 	var totalRecords int
+	var totalDuplicates int
 	var errors []error
 	var staleCount int
+	var circuitOpenCount int
+	var cancelledCount int
+	var timedOutCount int
 
 	for _, result := range results {
 		totalRecords += result.RecordCount
+		totalDuplicates += result.Duplicates
+
+		// Sources with an open circuit were not contacted and already alerted on
+		if result.CircuitOpen {
+			circuitOpenCount++
+			continue
+		}
+
+		// Runs cut short by shutdown are not failures of the source
+		if result.Cancelled {
+			cancelledCount++
+			continue
+		}
+
+		if result.TimedOut {
+			timedOutCount++
+		}
 
 		if result.IsStale {
 			staleCount++
@@ -246,12 +307,18 @@ func (app *Application) processAPIs() {
 		if result.HasError && result.Error != nil {
 			errors = append(errors, result.Error)
 
-			// Send error alert if alerts are enabled
-			if app.config.Global.EnableAlerts {
+			// Send error alert if alerts are enabled; limit errors get a limit alert instead
+			if app.config.Global.EnableAlerts && !processor.IsLimitError(result.Error) {
 				app.alertManager.SendErrorAlert(result.APIName, "processing", result.Error)
 			}
 		}
 
+		if app.config.Global.EnableAlerts {
+			for _, hit := range result.Limits {
+				app.alertManager.SendLimitAlert(result.APIName, hit.Limit, hit.Max, hit.Observed, hit.Behavior)
+			}
+		}
+
 		// Send staleness alert if needed
 		if result.IsStale && app.config.Global.EnableAlerts {
 			// Find the API config to get staleness details
@@ -267,23 +334,23 @@ func (app *Application) processAPIs() {
 
 	duration := time.Since(start)
 
-	// Send metrics if enabled
+	// Record metrics if enabled; they are sent on the flush interval
 	if app.config.Global.EnableMetrics {
-		app.sendCycleMetrics(duration, totalRecords, len(errors), staleCount)
-
-		// Send batch to New Relic
-		if err := app.metricsCollector.SendBatch(); err != nil {
-			app.logger.WithError(err).Error("Failed to send metrics batch")
-		}
+		app.sendCycleMetrics(schedule, duration, totalRecords, len(errors), staleCount)
 	}
 
 	app.logger.WithFields(logrus.Fields{
+		"schedule":      schedule,
 		"duration":      duration,
 		"total_records": totalRecords,
+		"duplicates":    totalDuplicates,
 		"errors":        len(errors),
 		"stale_count":   staleCount,
+		"circuit_open":  circuitOpenCount,
+		"cancelled":     cancelledCount,
+		"timed_out":     timedOutCount,
 		"api_count":     len(enabledAPIs),
-	}).Info("API processing cycle completed")
+	}).Info("API processing run completed")
 
 	// Log errors
 	for _, err := range errors {
@@ -291,11 +358,12 @@ func (app *Application) processAPIs() {
 	}
 }
 
-// sendCycleMetrics sends processing cycle metrics
-func (app *Application) sendCycleMetrics(duration time.Duration, recordCount, errorCount, staleCount int) {
+// sendCycleMetrics records metrics for one run of a schedule
+func (app *Application) sendCycleMetrics(schedule string, duration time.Duration, recordCount, errorCount, staleCount int) {
 	attributes := map[string]interface{}{
 		"service.name": app.config.Global.Name,
 		"version":      version,
+		"schedule":     schedule,
 	}
 
 	app.metricsCollector.AddMetric("flex.cycle.duration", "gauge", duration.Seconds(), attributes)
@@ -308,16 +376,19 @@ func (app *Application) sendCycleMetrics(duration time.Duration, recordCount, er
 func (app *Application) shutdown() {
 	app.logger.Info("Starting graceful shutdown")
 
+	// The application context is already cancelled, so the final flush and
+	// server shutdown get their own time limit
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+
 	// Send final metrics batch
 	if app.config.Global.EnableMetrics {
-		if err := app.metricsCollector.SendBatch(); err != nil {
+		if err := app.metricsCollector.SendBatch(shutdownCtx); err != nil {
 			app.logger.WithError(err).Error("Failed to send final metrics batch")
 		}
 	}
 
 	// Shutdown HTTP server
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer shutdownCancel()
 	
 	if err := app.httpServer.Stop(shutdownCtx); err != nil {
 		app.logger.WithError(err).Error("Failed to shutdown HTTP server gracefully")